@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requireAdmin restricts next to callers presenting the admin token as
+// "Authorization: Bearer <token>". Without a configured token the wrapped
+// endpoints are disabled altogether.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			writeError(w, http.StatusForbidden, "admin endpoints are disabled, set ADMIN_TOKEN to enable them")
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		ok := token != auth
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminMetricsHandler reports store-level activity, to be correlated with
+// the HTTP traffic.
+func (s *Server) adminMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	resp := map[string]any{
+		"items": s.store.Len(),
+		"store": s.store.Stats(),
+	}
+	if s.events != nil {
+		resp["events"] = s.events.Stats()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// adminTruncateHandler serves POST /admin/truncate?keep=N, which trims
+// the store down to its N most recently created items.
+func (s *Server) adminTruncateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r, "keep") {
+		return
+	}
+	v := r.URL.Query().Get("keep")
+	keep, err := strconv.Atoi(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid or missing keep %q", v))
+		return
+	}
+	removed, err := s.store.Truncate(keep)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"removed": len(removed)})
+}
+
+// adminReindexHandler serves POST /admin/reindex, which rebuilds the
+// store indexes and reports how long it took and their sizes.
+func (s *Server) adminReindexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	start := time.Now()
+	sizes := s.store.Reindex()
+	took := time.Since(start)
+	infof("reindexed the store in %s: %v", took, sizes)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"duration_ms": float64(took.Microseconds()) / 1000,
+		"indexes":     sizes,
+	})
+}
+
+// adminShutdownHandler serves POST /admin/shutdown?confirm=true, which
+// starts the same graceful shutdown as SIGTERM. Besides the admin token it
+// needs ADMIN_SHUTDOWN and the confirm parameter, so that neither a stray
+// request nor a leaked token alone can stop the server. It answers 202
+// right away; the response is sent before shutdown waits for in-flight
+// requests, this one included.
+func (s *Server) adminShutdownHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r, "confirm") {
+		return
+	}
+	if !s.cfg.AdminShutdown || s.shutdown == nil {
+		writeError(w, http.StatusForbidden, "remote shutdown is disabled, set ADMIN_SHUTDOWN=true to enable it")
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		writeError(w, http.StatusBadRequest, "add confirm=true to shut the server down")
+		return
+	}
+	source := fmt.Sprintf("%s (request %s, user agent %q)", r.RemoteAddr, requestID(r.Context()), r.UserAgent())
+	select {
+	case s.shutdown <- source:
+		infof("shutdown requested by %s", source)
+	default:
+		infof("shutdown requested again by %s, already under way", source)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "shutting down"})
+}
+
+// adminFlushHandler forces the store to disk and returns once it is
+// durable. A store that is not persisted answers 501 rather than claiming
+// a durability it does not have.
+func (s *Server) adminFlushHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	n, err := s.store.Flush()
+	if err != nil {
+		if !errors.Is(err, ErrNotPersistent) {
+			errorf("admin flush: %v", err)
+		}
+		s.writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"flushed": n})
+}
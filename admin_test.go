@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		headers []string
+		status  int
+	}{
+		{"disabled", "", []string{"Authorization", "Bearer secret"}, http.StatusForbidden},
+		{"no credentials", "secret", nil, http.StatusUnauthorized},
+		{"wrong token", "secret", []string{"Authorization", "Bearer nope"}, http.StatusUnauthorized},
+		{"not a bearer token", "secret", []string{"Authorization", "secret"}, http.StatusUnauthorized},
+		{"valid token", "secret", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, map[string]string{"ADMIN_TOKEN": tt.token})
+			for _, path := range []string{"/admin/metrics", "/admin/config"} {
+				if rec := do(t, h, http.MethodGet, path, "", tt.headers...); rec.Code != tt.status {
+					t.Errorf("%s: got status %d, want %d: %s", path, rec.Code, tt.status, rec.Body.String())
+				}
+			}
+		})
+	}
+}
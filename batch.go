@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// batchProgressEvery is how often, in items, a long import logs progress.
+const batchProgressEvery = 10000
+
+// ndjsonType is the media type of newline-delimited JSON, one value per
+// line.
+const ndjsonType = "application/x-ndjson"
+
+// batchResult is the response of a batch import.
+type batchResult struct {
+	Inserted int `json:"inserted"`
+	// Index and Offset locate the element that stopped the import: its
+	// position in the array and the byte offset reached in the body.
+	Index  *int   `json:"index,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchCreateHandler imports a JSON array of items. The array is decoded
+// one element at a time and each item is inserted as soon as it is read,
+// so memory stays bounded whatever the payload size. The import stops at
+// the first malformed or invalid element; items before it remain stored.
+//
+// With If-Generation-Match the import is all or nothing instead: the items
+// are decoded first, still bounded by the batch limits, then added in one
+// transaction that checks the store generation and answers 412 if the
+// store changed.
+//
+// A body of type application/x-ndjson is imported by batchNDJSONHandler
+// instead.
+func (s *Server) batchCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r, "on_error") {
+		return
+	}
+	if err := checkContentType(r, "application/json", ndjsonType); err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	gen, conditional, err := ifGenerationMatch(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == ndjsonType {
+		if conditional {
+			writeError(w, http.StatusBadRequest, "If-Generation-Match needs a JSON array batch, NDJSON lines are imported one by one")
+			return
+		}
+		s.batchNDJSONHandler(w, r)
+		return
+	}
+	if !checkAccept(w, r, "application/json") {
+		return
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxBatchBytes))
+	dec.DisallowUnknownFields()
+	var (
+		res batchResult
+		// pending holds the items of a conditional import until the
+		// transaction.
+		pending []Item
+	)
+	fail := func(index int, status int, err error) {
+		res.Index = &index
+		res.Offset = dec.InputOffset()
+		res.Error = err.Error()
+		writeJSON(w, status, res)
+	}
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		fail(0, http.StatusBadRequest, fmt.Errorf("request body must be a JSON array"))
+		return
+	}
+	for i := 0; dec.More(); i++ {
+		if i == s.cfg.Elements.MaxBatchItems {
+			fail(i, http.StatusRequestEntityTooLarge, s.cfg.Elements.tooManyItems())
+			return
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			fail(i, http.StatusBadRequest, fmt.Errorf("malformed item: %w", err))
+			return
+		}
+		var in newItem
+		if err := s.cfg.JSONLimits.decode(raw, &in); err != nil {
+			fail(i, http.StatusBadRequest, fmt.Errorf("malformed item: %w", describeDecodeError(err)))
+			return
+		}
+		if conditional {
+			pending = append(pending, in.item(s.cfg.CategoryDefaults))
+			continue
+		}
+		if _, err := s.store.AddItem(in.item(s.cfg.CategoryDefaults)); err != nil {
+			fail(i, errorStatus(err), err)
+			return
+		}
+		res.Inserted++
+		if res.Inserted%batchProgressEvery == 0 {
+			debugf("batch import: %d items inserted", res.Inserted)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		fail(res.Inserted+len(pending), http.StatusBadRequest, fmt.Errorf("malformed array end: %w", err))
+		return
+	}
+	if conditional {
+		failed := -1
+		err := s.store.WithTransaction(func(tx Tx) error {
+			if err := checkGeneration(tx, gen); err != nil {
+				return err
+			}
+			for i, it := range pending {
+				if _, err := tx.AddItem(it); err != nil {
+					failed = i
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if failed >= 0 {
+				res.Index = &failed
+			}
+			res.Error = err.Error()
+			writeJSON(w, errorStatus(err), res)
+			return
+		}
+		res.Inserted = len(pending)
+	}
+	s.writeData(w, r, http.StatusCreated, res, nil)
+}
+
+// ndjsonResult reports the outcome of one line of an NDJSON import.
+type ndjsonResult struct {
+	Line int `json:"line"`
+	// ID is the external ID of the created item, see Server.externalID.
+	ID     any    `json:"id,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchNDJSONHandler imports an NDJSON body, one item per line, and
+// answers with one NDJSON result per non-blank input line, in order: the
+// ID of the created item or the status and error of a failed line. Each
+// line is inserted as soon as it is read. With ?on_error=stop (the
+// default) the import ends after the first failed line; with
+// ?on_error=continue it carries on with the next line.
+//
+// The server cannot keep reading a request body once it has started the
+// response, so the results are buffered and sent when the body is done.
+// They are a few bytes per line, which still keeps memory far below the
+// size of the body. The status is 200 and failures are only reported per
+// line.
+func (s *Server) batchNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	stop := true
+	switch v := r.URL.Query().Get("on_error"); v {
+	case "", "stop":
+	case "continue":
+		stop = false
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid on_error %q, expected stop or continue", v))
+		return
+	}
+	if !checkAccept(w, r, ndjsonType) {
+		return
+	}
+
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, s.cfg.MaxBatchBytes))
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	defer func() {
+		w.Header().Set("Content-Type", ndjsonType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = out.WriteTo(w)
+	}()
+
+	var inserted, items int
+	for line := 1; ; line++ {
+		b, err := readLine(body, s.cfg.MaxBodyBytes)
+		if err != nil && err != io.EOF {
+			// The body itself failed: nothing more can be read.
+			_ = enc.Encode(ndjsonResult{Line: line, Status: http.StatusBadRequest, Error: err.Error()})
+			return
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			res := ndjsonResult{Line: line}
+			if items++; items > s.cfg.Elements.MaxBatchItems {
+				// The limit ends the import whatever on_error says.
+				res.Status, res.Error = http.StatusRequestEntityTooLarge, s.cfg.Elements.tooManyItems().Error()
+				_ = enc.Encode(res)
+				return
+			}
+			var in newItem
+			if derr := s.cfg.JSONLimits.decode(b, &in); derr != nil {
+				res.Status, res.Error = http.StatusBadRequest, fmt.Sprintf("malformed item: %v", describeDecodeError(derr))
+			} else if created, aerr := s.store.AddItem(in.item(s.cfg.CategoryDefaults)); aerr != nil {
+				res.Status, res.Error = errorStatus(aerr), aerr.Error()
+			} else {
+				res.ID = s.externalID(created.ID)
+				inserted++
+				if inserted%batchProgressEvery == 0 {
+					debugf("batch import: %d items inserted", inserted)
+				}
+			}
+			_ = enc.Encode(res)
+			if res.Error != "" && stop {
+				return
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+	}
+}
+
+// readLine reads up to and excluding the next newline. A line longer than
+// max is an error, so that one huge line cannot be buffered whole.
+func readLine(r *bufio.Reader, max int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if int64(len(line)) > max+1 {
+			return nil, fmt.Errorf("line longer than %d bytes", max)
+		}
+		switch err {
+		case nil:
+			return line[:len(line)-1], nil
+		case bufio.ErrBufferFull:
+			continue
+		default:
+			return line, err
+		}
+	}
+}
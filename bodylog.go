@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// BodyLogConfig controls the debug logging of request and response bodies.
+type BodyLogConfig struct {
+	Enabled bool
+	// MaxBytes is how much of each body is captured and logged.
+	MaxBytes int
+	// RedactFields lists JSON object keys, matched case-insensitively at
+	// any depth, whose values are replaced before logging.
+	RedactFields []string
+}
+
+const redacted = "[REDACTED]"
+
+// bodyLogMiddleware logs the bodies of every request and response. The
+// bodies are captured while the handler reads and writes them, up to
+// MaxBytes each, so streaming endpoints keep working. Capturing costs a
+// copy of every body and the logs may hold user data: keep it off outside
+// of debugging sessions.
+func bodyLogMiddleware(c BodyLogConfig, next http.Handler) http.Handler {
+	if !c.Enabled {
+		return next
+	}
+	redact := make(map[string]bool, len(c.RedactFields))
+	for _, f := range c.RedactFields {
+		redact[strings.ToLower(f)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody := &cappedBuffer{max: c.MaxBytes}
+		if r.Body != nil {
+			r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+		}
+		rec := &bodyRecorder{ResponseWriter: w, status: http.StatusOK, body: cappedBuffer{max: c.MaxBytes}}
+
+		next.ServeHTTP(rec, r)
+
+		infof("[%s] %s %s from %s request body=%s | response status=%d body=%s",
+			requestID(r.Context()), r.Method, r.URL.RequestURI(), r.RemoteAddr,
+			formatBody(reqBody, redact), rec.status, formatBody(&rec.body, redact))
+	})
+}
+
+// formatBody renders a captured body for the log, redacting JSON bodies.
+// Bodies that are not complete JSON documents, including ones cut at
+// MaxBytes, are logged as captured.
+func formatBody(b *cappedBuffer, redact map[string]bool) string {
+	if b.buf.Len() == 0 && b.dropped == 0 {
+		return "-"
+	}
+	raw := b.buf.Bytes()
+	var v any
+	if len(redact) > 0 && b.dropped == 0 && json.Unmarshal(raw, &v) == nil {
+		if out, err := json.Marshal(redactValue(v, redact)); err == nil {
+			raw = out
+		}
+	}
+	s := strings.TrimSpace(string(raw))
+	if b.dropped > 0 {
+		s += "…(truncated)"
+	}
+	return s
+}
+
+func redactValue(v any, redact map[string]bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			if redact[strings.ToLower(k)] {
+				t[k] = redacted
+			} else {
+				t[k] = redactValue(e, redact)
+			}
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = redactValue(e, redact)
+		}
+	}
+	return v
+}
+
+// cappedBuffer keeps the first max bytes written to it and counts the rest.
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.max - b.buf.Len()
+	if room > len(p) {
+		room = len(p)
+	}
+	if room > 0 {
+		b.buf.Write(p[:room])
+	}
+	b.dropped += len(p) - room
+	return len(p), nil
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyRecorder is a ResponseWriter capturing the status and the start of
+// the body on their way to the client.
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   cappedBuffer
+}
+
+func (r *bodyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bodyRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *bodyRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *bodyRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
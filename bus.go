@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventBus fans the mutation events published by EventStore out to the
+// in-process consumers subscribed to it, such as the webhook dispatcher.
+// The store knows nothing of its consumers, and a new reaction to changes
+// only needs a subscription.
+//
+// Each subscription has its own bounded queue, so a slow consumer only
+// ever fills its own: what happens then is the queue policy of that
+// subscription, and publishing never waits longer than a block policy
+// allows.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+	// n mirrors len(subs) for the lock-free Active.
+	n atomic.Int32
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription is the queue of one consumer of an EventBus.
+type Subscription struct {
+	name  string
+	queue chan Event
+	// policy is one of drop-new, drop-oldest and block; block waits up to
+	// blockTimeout for room before dropping the event.
+	policy       string
+	blockTimeout time.Duration
+
+	published, dropped atomic.Int64
+}
+
+// Subscribe registers a consumer whose queue holds up to size events and
+// applies policy when full. The consumer reads the events from Events
+// until it unsubscribes.
+func (b *EventBus) Subscribe(name string, size int, policy string, blockTimeout time.Duration) *Subscription {
+	sub := &Subscription{name: name, queue: make(chan Event, size), policy: policy, blockTimeout: blockTimeout}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[sub] = struct{}{}
+	b.n.Add(1)
+	return sub
+}
+
+// Unsubscribe stops publishing to sub and closes its queue; the events
+// already queued can still be read. It is safe to call more than once.
+func (b *EventBus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		b.n.Add(-1)
+		close(sub.queue)
+	}
+}
+
+// Active reports whether anyone is subscribed, so that publishers can skip
+// the work of building events nobody reads.
+func (b *EventBus) Active() bool {
+	return b.n.Load() > 0
+}
+
+// Publish offers ev to every subscription.
+func (b *EventBus) Publish(ev Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		sub.offer(ev)
+	}
+}
+
+// Events returns the queue of the subscription, closed by Unsubscribe.
+func (s *Subscription) Events() <-chan Event {
+	return s.queue
+}
+
+// offer queues ev, applying the queue policy when the queue is full.
+func (s *Subscription) offer(ev Event) {
+	s.published.Add(1)
+	select {
+	case s.queue <- ev:
+		return
+	default:
+	}
+	switch s.policy {
+	case queueDropOldest:
+		for {
+			select {
+			case <-s.queue:
+				s.dropped.Add(1)
+			default:
+			}
+			select {
+			case s.queue <- ev:
+				return
+			default:
+			}
+		}
+	case queueBlock:
+		t := time.NewTimer(s.blockTimeout)
+		defer t.Stop()
+		select {
+		case s.queue <- ev:
+			return
+		case <-t.C:
+		}
+	}
+	s.dropped.Add(1)
+}
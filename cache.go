@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etagEpoch distinguishes the generations of this process from those of
+// previous runs, which restart from zero with possibly different contents.
+var etagEpoch = func() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}()
+
+// collectionETag identifies the state of the store, and therefore the
+// representation of any listing URL, from its generation gen.
+func (s *Server) collectionETag(gen uint64) string {
+	return fmt.Sprintf(`"%s-%d"`, etagEpoch, gen)
+}
+
+// weakETag marks etag as weak: it identifies the content of a response
+// rather than its exact bytes, which can vary, for instance, with the
+// content encoding.
+func weakETag(etag string) string {
+	return "W/" + etag
+}
+
+// itemETag is the strong entity tag of one item, derived from its JSON
+// representation so that it changes whenever the item does.
+func itemETag(it Item) string {
+	b, err := json.Marshal(it)
+	if err != nil {
+		panic(err)
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// contentETag is itemETag ignoring the ID and timestamps, which tells
+// whether two items hold the same content.
+func contentETag(it Item) string {
+	it.ID, it.CreatedAt, it.UpdatedAt = 0, time.Time{}, time.Time{}
+	return itemETag(it)
+}
+
+// ifMatch turns the If-Match header of r into an update precondition. It
+// returns nil when the header is absent.
+func ifMatch(r *http.Request) func(Item) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	return func(current Item) error {
+		if etag := itemETag(current); !etagMatches(header, etag, false) {
+			return fmt.Errorf("item %d has changed, its current ETag is %s: %w", current.ID, etag, ErrPreconditionFailed)
+		}
+		return nil
+	}
+}
+
+// ifGenerationMatch parses the If-Generation-Match header of r, the store
+// generation a bulk write is conditional on. It reports false when the
+// header is absent.
+func ifGenerationMatch(r *http.Request) (uint64, bool, error) {
+	v := r.Header.Get("If-Generation-Match")
+	if v == "" {
+		return 0, false, nil
+	}
+	gen, err := strconv.ParseUint(strings.Trim(strings.TrimSpace(v), `"`), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid If-Generation-Match %q, expected a store generation", v)
+	}
+	return gen, true, nil
+}
+
+// checkGeneration fails with ErrPreconditionFailed unless the store tx
+// runs on is at generation gen.
+func checkGeneration(tx Tx, gen uint64) error {
+	if cur := tx.Generation(); cur != gen {
+		return fmt.Errorf("store is at generation %d, not %d: %w", cur, gen, ErrPreconditionFailed)
+	}
+	return nil
+}
+
+// setCacheHeaders sets Cache-Control on a GET response according to the
+// configured max-age. A zero max-age still lets clients cache the response
+// but requires them to revalidate it first.
+func (s *Server) setCacheHeaders(w http.ResponseWriter) {
+	if maxAge := s.live.Load().cacheMaxAge; maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+}
+
+// etagMatches reports whether an If-None-Match or If-Match header value
+// lists etag. If-None-Match uses the weak comparison, which ignores the W/
+// prefix of either tag; If-Match uses the strong one, where a weak tag
+// never matches.
+func etagMatches(header, etag string, weak bool) bool {
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag of the response and, if the request already
+// holds that version, answers 304 and reports true.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPutIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		record bool
+	}{
+		{"memory", false},
+		{"recording", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			path := filepath.Join(t.TempDir(), "ops.jsonl")
+			if tt.record {
+				env["RECORD_FILE"] = path
+			}
+			s, h := newTestServer(t, env)
+			rec := mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"a","value":1}`)
+			etag := rec.Header().Get("ETag")
+			if etag == "" {
+				etag = mustDo(t, h, http.StatusOK, http.MethodGet, "/items/1", "").Header().Get("ETag")
+			}
+
+			steps := []struct {
+				name    string
+				ifMatch string
+				status  int
+			}{
+				{"missing", "", http.StatusOK},
+				{"stale", etag, http.StatusPreconditionFailed},
+				{"wildcard", "*", http.StatusOK},
+				{"malformed", "not-an-etag", http.StatusPreconditionFailed},
+			}
+			value := 1
+			for _, st := range steps {
+				value++
+				var headers []string
+				if st.ifMatch != "" {
+					headers = []string{"If-Match", st.ifMatch}
+				}
+				body := `{"name":"a","value":` + strconv.Itoa(value) + `}`
+				rec := do(t, h, http.MethodPut, "/items/1", body, headers...)
+				if rec.Code != st.status {
+					t.Fatalf("%s: got status %d, want %d: %s", st.name, rec.Code, st.status, rec.Body.String())
+				}
+				if st.status == http.StatusOK {
+					etag = rec.Header().Get("ETag")
+				} else {
+					value--
+				}
+			}
+			current := mustDo(t, h, http.StatusOK, http.MethodGet, "/items/1", "")
+			if got := current.Header().Get("ETag"); got != etag {
+				t.Fatalf("GET answers ETag %s, the last PUT %s", got, etag)
+			}
+			mustDo(t, h, http.StatusOK, http.MethodPut, "/items/1", `{"name":"a","value":10}`, "If-Match", etag)
+			mustDo(t, h, http.StatusPreconditionFailed, http.MethodPut, "/items/1", `{"name":"a","value":11}`, "If-Match", etag)
+
+			if !tt.record {
+				return
+			}
+			replayed, err := NewMemoryStore()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Replay(replayed, path); err != nil {
+				t.Fatalf("replaying the recording: %v", err)
+			}
+			want, _ := s.store.GetItem(1)
+			got, err := replayed.GetItem(1)
+			if err != nil || got.Value != want.Value {
+				t.Errorf("replayed item %+v, %v, want value %d", got, err, want.Value)
+			}
+		})
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"REQUIRE_IF_MATCH": "true"})
+	etag := mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"a","value":1}`).Header().Get("ETag")
+	if etag == "" {
+		etag = mustDo(t, h, http.StatusOK, http.MethodGet, "/items/1", "").Header().Get("ETag")
+	}
+	mustDo(t, h, http.StatusPreconditionRequired, http.MethodPut, "/items/1", `{"name":"a","value":2}`)
+	mustDo(t, h, http.StatusOK, http.MethodPut, "/items/1", `{"name":"a","value":2}`, "If-Match", etag)
+}
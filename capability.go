@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// capabilities group the endpoints, by method and path as listed in
+// endpoints, that DISABLED_CAPABILITIES can switch off together. An
+// endpoint can belong to several.
+var capabilities = map[string][]string{
+	"write": {
+		"POST /items", "PUT /items/{id}", "PATCH /items/{id}", "DELETE /items/{id}",
+		"POST /items/{id}/copy", "POST /items/{id}/pop", "POST /items/{id}/increment",
+		"PUT /items/{id}/value", "POST /items/batch", "POST /items/swap",
+		"POST /items/bulk-upsert-by-name", "POST /admin/import", "POST /admin/truncate",
+	},
+	"delete": {"DELETE /items/{id}", "POST /items/{id}/pop", "POST /admin/truncate"},
+	"export": {"GET /items/export.{csv,json,jsonl}", "GET /admin/export", "GET /admin/backup"},
+	"bulk": {
+		"POST /items/batch", "POST /items/bulk-upsert-by-name", "POST /items/import/validate",
+		"POST /admin/import",
+	},
+}
+
+// parseCapabilities checks a list of capability names.
+func parseCapabilities(names []string) ([]string, error) {
+	for _, n := range names {
+		if _, ok := capabilities[n]; !ok {
+			known := make([]string, 0, len(capabilities))
+			for k := range capabilities {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown capability %q, expected one of %s", n, strings.Join(known, ", "))
+		}
+	}
+	return names, nil
+}
+
+// enabledEndpoints returns the endpoints left once the disabled
+// capabilities are removed, for the index and the Postman collection.
+func enabledEndpoints(disabled map[string]bool) []endpoint {
+	if len(disabled) == 0 {
+		return endpoints
+	}
+	var out []endpoint
+	for _, e := range endpoints {
+		if !disabled[e.Method+" "+e.Path] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// disabledEndpoints returns the endpoints of the named capabilities.
+func disabledEndpoints(names []string) map[string]bool {
+	disabled := make(map[string]bool)
+	for _, n := range names {
+		for _, key := range capabilities[n] {
+			disabled[key] = true
+		}
+	}
+	return disabled
+}
+
+// idHandler serves a route below /items/{id}.
+type idHandler func(w http.ResponseWriter, r *http.Request, id int)
+
+// endpointMethods splits the methods of the endpoints of path, as listed
+// in endpoints, into the enabled and the disabled ones. HEAD is allowed
+// along with GET.
+func endpointMethods(path string, disabled map[string]bool) (allowed, off []string) {
+	for _, e := range endpoints {
+		if e.Path != path {
+			continue
+		}
+		if disabled[e.Method+" "+e.Path] {
+			off = append(off, e.Method)
+			continue
+		}
+		allowed = append(allowed, e.Method)
+		if e.Method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	return allowed, off
+}
+
+// offMethod reports whether r is for one of the methods of off.
+func offMethod(r *http.Request, off []string) bool {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, m := range off {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns h as routes registers it for path, an endpoint path as
+// listed in endpoints, with the disabled capabilities left out: nil when
+// every endpoint of path is disabled, so that it is not registered at all,
+// h itself when none is, and otherwise h answering 405 to the disabled
+// methods as it does to the methods it does not serve.
+func (s *Server) route(path string, h http.HandlerFunc) http.HandlerFunc {
+	allowed, off := endpointMethods(path, s.disabled)
+	switch {
+	case len(off) == 0:
+		return h
+	case len(allowed) == 0:
+		return nil
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if offMethod(r, off) {
+			methodNotAllowed(w, allowed...)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// routeID is route for the routes below /items/{id}.
+func (s *Server) routeID(path string, h idHandler) idHandler {
+	allowed, off := endpointMethods(path, s.disabled)
+	switch {
+	case len(off) == 0:
+		return h
+	case len(allowed) == 0:
+		return nil
+	}
+	return func(w http.ResponseWriter, r *http.Request, id int) {
+		if offMethod(r, off) {
+			methodNotAllowed(w, allowed...)
+			return
+		}
+		h(w, r, id)
+	}
+}
+
+// handle registers h on mux for path, an exact path listed in endpoints,
+// unless its capabilities are disabled.
+func (s *Server) handle(mux *http.ServeMux, path string, h http.HandlerFunc) {
+	if h = s.route(path, h); h != nil {
+		mux.HandleFunc(path, h)
+	}
+}
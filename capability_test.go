@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCapabilityEndpointsListed(t *testing.T) {
+	listed := make(map[string]bool, len(endpoints))
+	for _, e := range endpoints {
+		listed[e.Method+" "+e.Path] = true
+	}
+	for name, keys := range capabilities {
+		for _, key := range keys {
+			if !listed[key] {
+				t.Errorf("capability %s: %s is not an endpoint", name, key)
+			}
+		}
+	}
+}
+
+// endpointRequest returns the method and a path serving endpoint key.
+func endpointRequest(key string) (string, string) {
+	method, path, _ := strings.Cut(key, " ")
+	path = strings.Replace(path, "{id}", "1", 1)
+	path = strings.Replace(path, "{csv,json,jsonl}", "csv", 1)
+	return method, path
+}
+
+// unknownRoute reports whether body is the error of an unknown path or item
+// action.
+func unknownRoute(body string) bool {
+	body = strings.TrimSpace(body)
+	return body == `{"error":"not found"}` || strings.HasPrefix(body, `{"error":"unknown item action`)
+}
+
+func TestDisabledCapabilities(t *testing.T) {
+	for name, keys := range capabilities {
+		t.Run(name, func(t *testing.T) {
+			_, on := newTestServer(t, map[string]string{"ADMIN_TOKEN": "secret"})
+			_, off := newTestServer(t, map[string]string{"ADMIN_TOKEN": "secret", "DISABLED_CAPABILITIES": name})
+			for _, key := range keys {
+				method, path := endpointRequest(key)
+				rec := do(t, off, method, path, "", "Authorization", "Bearer secret")
+				switch rec.Code {
+				case http.StatusNotFound:
+					if !unknownRoute(rec.Body.String()) {
+						t.Errorf("%s: got %s, want the 404 of unknown routes", key, rec.Body.String())
+					}
+				case http.StatusMethodNotAllowed:
+					if allow := rec.Header().Get("Allow"); strings.Contains(allow, method) {
+						t.Errorf("%s: Allow %q lists the disabled method", key, allow)
+					}
+				default:
+					t.Errorf("%s: got status %d with %s disabled, want 404 or 405", key, rec.Code, name)
+				}
+				if rec := do(t, on, method, path, "", "Authorization", "Bearer secret"); rec.Code == http.StatusMethodNotAllowed || unknownRoute(rec.Body.String()) {
+					t.Errorf("%s: got status %d with nothing disabled", key, rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestDisabledCapabilityRoutes(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"DISABLED_CAPABILITIES": "write"})
+	rec := mustDo(t, h, http.StatusMethodNotAllowed, http.MethodPost, "/items", `{"name":"widget"}`)
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("POST /items: got Allow %q, want GET, HEAD", allow)
+	}
+	mustDo(t, h, http.StatusOK, http.MethodGet, "/items", "")
+	rec = mustDo(t, h, http.StatusMethodNotAllowed, http.MethodPut, "/items/1/value", `{"value":1}`)
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("PUT /items/1/value: got Allow %q, want GET, HEAD", allow)
+	}
+	mustDo(t, h, http.StatusNotFound, http.MethodPost, "/items/1/copy", "")
+	mustDo(t, h, http.StatusNotFound, http.MethodPost, "/items/batch", "[]")
+	mustDo(t, h, http.StatusNotFound, http.MethodGet, "/items/1", "")
+
+	var index struct {
+		Endpoints []endpoint `json:"endpoints"`
+	}
+	if err := json.Unmarshal(mustDo(t, h, http.StatusOK, http.MethodGet, "/", "").Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	off := disabledEndpoints([]string{"write"})
+	for _, e := range index.Endpoints {
+		if off[e.Method+" "+e.Path] {
+			t.Errorf("the index lists %s %s", e.Method, e.Path)
+		}
+	}
+}
+
+func TestExportCapabilityBackup(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"ADMIN_TOKEN": "secret"})
+	mustDo(t, h, http.StatusOK, http.MethodGet, "/admin/backup", "", "Authorization", "Bearer secret")
+
+	_, h = newTestServer(t, map[string]string{"ADMIN_TOKEN": "secret", "DISABLED_CAPABILITIES": "export"})
+	for _, path := range []string{"/admin/backup", "/admin/export", "/items/export.csv"} {
+		mustDo(t, h, http.StatusNotFound, http.MethodGet, path, "", "Authorization", "Bearer secret")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ChaosConfig injects latency and failures into responses, to exercise the
+// timeout and retry handling of clients. It is meant for test
+// environments only and is off unless one of its fields is set.
+type ChaosConfig struct {
+	// Each request is delayed by a random duration between DelayMin and
+	// DelayMax.
+	DelayMin, DelayMax time.Duration
+	// ErrorRate is the probability, between 0 and 1, that a request is
+	// answered 500 without reaching its handler.
+	ErrorRate float64
+}
+
+func (c ChaosConfig) enabled() bool {
+	return c.DelayMax > 0 || c.ErrorRate > 0
+}
+
+// chaosMiddleware applies c to every request except the health probes,
+// which would otherwise get the pod restarted. A client that goes away
+// during the delay ends the request at once.
+func chaosMiddleware(c ChaosConfig, next http.Handler) http.Handler {
+	if !c.enabled() {
+		return next
+	}
+	infof("chaos enabled: delay %s-%s, error rate %g", c.DelayMin, c.DelayMax, c.ErrorRate)
+	var (
+		mu  sync.Mutex
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if healthProbe(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mu.Lock()
+		delay := c.DelayMin
+		if span := c.DelayMax - c.DelayMin; span > 0 {
+			delay += time.Duration(rnd.Int63n(int64(span) + 1))
+		}
+		fail := rnd.Float64() < c.ErrorRate
+		mu.Unlock()
+
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+		if fail {
+			writeError(w, http.StatusInternalServerError, "injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
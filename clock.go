@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock tells the store the time to stamp items with. Tests can inject a
+// fixed or stepping clock with WithClock to get deterministic timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// WithClock makes the store read the time from c instead of the wall
+// clock.
+func WithClock(c Clock) StoreOption {
+	return func(s *MemoryStore) error {
+		if c == nil {
+			return fmt.Errorf("clock must not be nil")
+		}
+		s.clock = c
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// stepClock starts at a fixed time and moves a second forward on every
+// reading.
+type stepClock struct {
+	now time.Time
+}
+
+func (c *stepClock) Now() time.Time {
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func TestStoreClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	store, err := NewMemoryStore(WithClock(&stepClock{now: start}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name             string
+		op               func() (Item, error)
+		created, updated time.Time
+	}{
+		{"add", func() (Item, error) { return store.AddItem(Item{Name: "a"}) }, at(1), at(1)},
+		{"update", func() (Item, error) { return store.UpdateItem(1, Item{Name: "a", Value: 2}) }, at(1), at(2)},
+		{"copy", func() (Item, error) { return store.CopyItem(1, true) }, at(3), at(3)},
+		{"swap", func() (Item, error) {
+			if err := store.SwapValues(1, 2); err != nil {
+				return Item{}, err
+			}
+			return store.GetItem(1)
+		}, at(1), at(4)},
+	}
+	for _, st := range steps {
+		it, err := st.op()
+		if err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+		if !it.CreatedAt.Equal(st.created) || !it.UpdatedAt.Equal(st.updated) {
+			t.Errorf("%s: got created %s, updated %s, want %s, %s", st.name, it.CreatedAt, it.UpdatedAt, st.created, st.updated)
+		}
+	}
+	if _, err := NewMemoryStore(WithClock(nil)); err == nil {
+		t.Error("WithClock(nil) was accepted")
+	}
+}
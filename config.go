@@ -0,0 +1,758 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings of the service, read from the
+// environment at startup.
+type Config struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string
+	// MaxBodyBytes caps the size of request bodies accepted by write
+	// handlers.
+	MaxBodyBytes int64
+	// MaxHeaderBytes caps the size of the request line and headers, which
+	// the HTTP server answers 431 past.
+	MaxHeaderBytes int
+	// MaxHeaders caps the number of header fields of a request.
+	MaxHeaders int
+	// MaxConnections caps the number of open client connections, see
+	// limitListener. Zero is unlimited.
+	MaxConnections int
+	// Elements bounds the number of IDs, items and rows of a request.
+	Elements ElementLimits
+	// MaxBatchBytes caps the body of streamed batch imports, which are not
+	// buffered and can therefore be much larger than MaxBodyBytes.
+	MaxBatchBytes int64
+	// JSONLimits bounds the nesting and token count of JSON bodies, or of
+	// each element of a batch.
+	JSONLimits JSONLimits
+	// UniqueNames rejects items whose name is already taken.
+	UniqueNames bool
+	// NormalizeNames trims and collapses whitespace in names before they
+	// are validated and stored.
+	NormalizeNames bool
+	// CaseSensitiveNames makes names differing only by case distinct, for
+	// the name filter as for uniqueness.
+	CaseSensitiveNames bool
+	// IndexFields lists the fields the store keeps a secondary index on.
+	IndexFields []string
+	// DisabledCapabilities lists the groups of endpoints switched off, see
+	// capabilities.
+	DisabledCapabilities []string
+	ItemLimits           ItemLimits
+	// NameDenyList lists the rules of blocked names, NameDenyListFile a
+	// file of more rules, one per line, reloaded on SIGHUP.
+	NameDenyList     []string
+	NameDenyListFile string
+	// CategoryDefaults maps lowercase categories to the value given to new
+	// items of that category created without one.
+	CategoryDefaults map[string]int
+	// Shards, above 1, spreads the items over that many stores, see
+	// ShardedRouter.
+	Shards int
+	// IDStart and IDStep define the sequence of item IDs, see
+	// WithIDSequence.
+	IDStart, IDStep int
+	// ShutdownTimeout bounds how long a graceful shutdown waits for
+	// in-flight requests before closing connections.
+	ShutdownTimeout time.Duration
+	// StoreRetryAfter is the Retry-After sent with 503 answers to
+	// transient store failures.
+	StoreRetryAfter time.Duration
+	// StoreRetry bounds the retries of idempotent store calls by GET, PUT
+	// and DELETE handlers.
+	StoreRetry RetryConfig
+	CORS       CORSConfig
+	Quota      QuotaConfig
+	Events     EventConfig
+	Persist    PersistConfig
+	Replica    ReplicaConfig
+	BodyLog    BodyLogConfig
+	Chaos      ChaosConfig
+	Gzip       GzipConfig
+	RequestID  RequestIDConfig
+	// ListTimeBudget bounds the time a listing spends scanning the store;
+	// past it, the items found so far are returned as a partial listing.
+	// Zero disables the budget.
+	ListTimeBudget time.Duration
+	// ObfuscateIDs shows clients opaque tokens instead of item IDs, derived
+	// from IDSalt, see IDCodec.
+	ObfuscateIDs bool
+	IDSalt       string
+	// StrictQuery rejects requests carrying query parameters their
+	// endpoint does not read, see checkQuery.
+	StrictQuery bool
+	// LongPollMaxWait caps the ?wait= of a long-polling listing.
+	LongPollMaxWait time.Duration
+	// TrustProxy takes the client address, scheme and host from the
+	// X-Forwarded-* headers, see proxyMiddleware.
+	TrustProxy bool
+	// RecordFile, when set, receives every store mutation as JSON lines.
+	RecordFile string
+	// ReplayFile, when set, is a recording applied to the store at startup.
+	ReplayFile string
+	// SeedFile, when set, is a JSON array of items added at startup.
+	SeedFile string
+	// SeedOnlyIfEmpty skips seeding a store that already holds items.
+	SeedOnlyIfEmpty bool
+	// DefaultSort is the ?sort= specification applied to listings that do
+	// not give one.
+	DefaultSort string
+	// EmptyList is how list endpoints answer when they have nothing to
+	// return: "array", "null" or "204".
+	EmptyList string
+	// RequireIfMatch rejects item updates sent without If-Match.
+	RequireIfMatch bool
+	// ReadOnly refuses every write outside the admin endpoints.
+	ReadOnly bool
+	// LogLevel drops the log messages below it.
+	LogLevel logLevel
+	// Envelope wraps every successful item response in
+	// {"data": ..., "meta": {...}}.
+	Envelope bool
+	// GroupNoneKey is the group of /items/grouped holding the items
+	// without a category, or without tags.
+	GroupNoneKey string
+	// JSONNaming is the field naming convention of JSON responses,
+	// "snake_case" or "camelCase", unless the request asks for the other.
+	JSONNaming string
+	// CacheMaxAge is the Cache-Control max-age of GET responses, in
+	// seconds. Zero makes clients revalidate every time.
+	CacheMaxAge int
+	// AdminToken is the bearer token required by the admin endpoints,
+	// which are disabled when it is empty.
+	AdminToken string
+	// AdminShutdown enables POST /admin/shutdown.
+	AdminShutdown bool
+	// RootRedirect, when set, makes "/" redirect there instead of serving
+	// the endpoint index.
+	RootRedirect string
+	// Settings holds the effective value of every environment variable
+	// read by loadConfig, defaults included, by name.
+	Settings map[string]string
+}
+
+// settingSet collects the settings read by the env helpers during one
+// loadConfig, by name.
+type settingSet map[string]string
+
+func (s settingSet) note(key, v string) {
+	s[key] = v
+}
+
+func loadConfig() (Config, error) {
+	set := make(settingSet)
+
+	cfg := Config{
+		Addr:         envString(set, "ADDR", ":8080"),
+		DefaultSort:  envString(set, "DEFAULT_SORT", "id"),
+		EmptyList:    envString(set, "EMPTY_LIST", emptyListArray),
+		JSONNaming:   envString(set, "JSON_NAMING", namingSnake),
+		GroupNoneKey: envString(set, "GROUPED_NONE_KEY", "_none"),
+		RootRedirect: envString(set, "ROOT_REDIRECT", ""),
+		AdminToken:   envString(set, "ADMIN_TOKEN", ""),
+		RecordFile:   envString(set, "RECORD_FILE", ""),
+		ReplayFile:   envString(set, "REPLAY_FILE", ""),
+		SeedFile:     envString(set, "SEED_FILE", ""),
+	}
+
+	maxBody, err := envInt(set, "MAX_BODY_BYTES", 1<<20)
+	if err != nil {
+		return Config{}, err
+	}
+	if maxBody < 1 {
+		return Config{}, fmt.Errorf("MAX_BODY_BYTES must be positive, got %d", maxBody)
+	}
+	cfg.MaxBodyBytes = int64(maxBody)
+
+	maxBatch, err := envInt(set, "MAX_BATCH_BYTES", 256<<20)
+	if err != nil {
+		return Config{}, err
+	}
+	if maxBatch < 1 {
+		return Config{}, fmt.Errorf("MAX_BATCH_BYTES must be positive, got %d", maxBatch)
+	}
+	cfg.MaxBatchBytes = int64(maxBatch)
+	if cfg.MaxHeaderBytes, err = envInt(set, "MAX_HEADER_BYTES", 64<<10); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxHeaderBytes < 1 {
+		return Config{}, fmt.Errorf("MAX_HEADER_BYTES must be positive, got %d", cfg.MaxHeaderBytes)
+	}
+	if cfg.MaxHeaders, err = envInt(set, "MAX_HEADERS", 100); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxHeaders < 1 {
+		return Config{}, fmt.Errorf("MAX_HEADERS must be positive, got %d", cfg.MaxHeaders)
+	}
+	if cfg.MaxConnections, err = envInt(set, "MAX_CONNECTIONS", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxConnections < 0 {
+		return Config{}, fmt.Errorf("MAX_CONNECTIONS must not be negative, got %d", cfg.MaxConnections)
+	}
+	if cfg.Elements, err = loadElementLimits(set); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.JSONLimits.MaxDepth, err = envInt(set, "JSON_MAX_DEPTH", 32); err != nil {
+		return Config{}, err
+	}
+	if cfg.JSONLimits.MaxDepth < 1 {
+		return Config{}, fmt.Errorf("JSON_MAX_DEPTH must be positive, got %d", cfg.JSONLimits.MaxDepth)
+	}
+	if cfg.JSONLimits.MaxTokens, err = envInt(set, "JSON_MAX_TOKENS", 100000); err != nil {
+		return Config{}, err
+	}
+	if cfg.JSONLimits.MaxTokens < 1 {
+		return Config{}, fmt.Errorf("JSON_MAX_TOKENS must be positive, got %d", cfg.JSONLimits.MaxTokens)
+	}
+
+	if cfg.UniqueNames, err = envBool(set, "UNIQUE_NAMES", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.NormalizeNames, err = envBool(set, "NORMALIZE_NAMES", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.CaseSensitiveNames, err = envBool(set, "CASE_SENSITIVE_NAMES", false); err != nil {
+		return Config{}, err
+	}
+	cfg.IndexFields = envList(set, "INDEX_FIELDS", nil)
+	if cfg.DisabledCapabilities, err = parseCapabilities(envList(set, "DISABLED_CAPABILITIES", nil)); err != nil {
+		return Config{}, fmt.Errorf("invalid DISABLED_CAPABILITIES: %w", err)
+	}
+	switch cfg.EmptyList {
+	case emptyListArray, emptyListNull, emptyListNoContent:
+	default:
+		return Config{}, fmt.Errorf("invalid EMPTY_LIST %q, expected array, null or 204", cfg.EmptyList)
+	}
+	if cfg.JSONNaming != namingSnake && cfg.JSONNaming != namingCamel {
+		return Config{}, fmt.Errorf("invalid JSON_NAMING %q, expected snake_case or camelCase", cfg.JSONNaming)
+	}
+	if _, err := parseSort(cfg.DefaultSort); err != nil {
+		return Config{}, fmt.Errorf("invalid DEFAULT_SORT: %w", err)
+	}
+	if cfg.SeedOnlyIfEmpty, err = envBool(set, "SEED_ONLY_IF_EMPTY", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.RequireIfMatch, err = envBool(set, "REQUIRE_IF_MATCH", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.Envelope, err = envBool(set, "RESPONSE_ENVELOPE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReadOnly, err = envBool(set, "READ_ONLY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.LogLevel, err = parseLogLevel(envString(set, "LOG_LEVEL", "info")); err != nil {
+		return Config{}, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	set.note("LOG_LEVEL", cfg.LogLevel.String())
+	if cfg.ItemLimits.MaxTags, err = envInt(set, "MAX_TAGS", DefaultItemLimits.MaxTags); err != nil {
+		return Config{}, err
+	}
+	if cfg.ItemLimits.MaxTagLength, err = envInt(set, "MAX_TAG_LENGTH", DefaultItemLimits.MaxTagLength); err != nil {
+		return Config{}, err
+	}
+	if cfg.ItemLimits.MaxMetadataKeys, err = envInt(set, "MAX_METADATA_KEYS", DefaultItemLimits.MaxMetadataKeys); err != nil {
+		return Config{}, err
+	}
+	if cfg.ItemLimits.MaxMetadataBytes, err = envInt(set, "MAX_METADATA_BYTES", DefaultItemLimits.MaxMetadataBytes); err != nil {
+		return Config{}, err
+	}
+	cfg.ItemLimits.NameCharset = envString(set, "NAME_CHARSET", DefaultItemLimits.NameCharset)
+	if _, ok := nameCharsets[cfg.ItemLimits.NameCharset]; !ok {
+		return Config{}, fmt.Errorf("invalid NAME_CHARSET %q, expected printable, printable+tab, ascii or any", cfg.ItemLimits.NameCharset)
+	}
+	cfg.NameDenyList = envList(set, "NAME_DENYLIST", nil)
+	cfg.NameDenyListFile = envString(set, "NAME_DENYLIST_FILE", "")
+	if cfg.Shards, err = envInt(set, "STORE_SHARDS", 1); err != nil {
+		return Config{}, err
+	}
+	if cfg.Shards < 1 {
+		return Config{}, fmt.Errorf("STORE_SHARDS must be positive, got %d", cfg.Shards)
+	}
+	if cfg.CategoryDefaults, err = parseCategoryDefaults(envList(set, "CATEGORY_DEFAULTS", nil)); err != nil {
+		return Config{}, fmt.Errorf("invalid CATEGORY_DEFAULTS: %w", err)
+	}
+	if cfg.IDStart, err = envInt(set, "ID_START", 1); err != nil {
+		return Config{}, err
+	}
+	if cfg.IDStep, err = envInt(set, "ID_STEP", 1); err != nil {
+		return Config{}, err
+	}
+	if cfg.ShutdownTimeout, err = envDuration(set, "SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return Config{}, fmt.Errorf("SHUTDOWN_TIMEOUT must be positive, got %s", cfg.ShutdownTimeout)
+	}
+
+	if cfg.StoreRetryAfter, err = envDuration(set, "STORE_RETRY_AFTER", 5*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.StoreRetryAfter < time.Second {
+		return Config{}, fmt.Errorf("STORE_RETRY_AFTER must be at least 1s, got %s", cfg.StoreRetryAfter)
+	}
+	if cfg.CacheMaxAge, err = envInt(set, "CACHE_MAX_AGE", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.CacheMaxAge < 0 {
+		return Config{}, fmt.Errorf("CACHE_MAX_AGE must not be negative, got %d", cfg.CacheMaxAge)
+	}
+	if cfg.CORS, err = loadCORSConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Quota, err = loadQuotaConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Events, err = loadEventConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Persist, err = loadPersistConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Replica, err = loadReplicaConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Shards > 1 && cfg.Persist.Path != "" {
+		return Config{}, fmt.Errorf("STORE_SHARDS cannot be combined with DATA_FILE, sharded stores are not persisted")
+	}
+	if cfg.ListTimeBudget, err = envDuration(set, "LIST_TIME_BUDGET", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ListTimeBudget < 0 {
+		return Config{}, fmt.Errorf("LIST_TIME_BUDGET must not be negative, got %s", cfg.ListTimeBudget)
+	}
+	if cfg.ObfuscateIDs, err = envBool(set, "OBFUSCATE_IDS", false); err != nil {
+		return Config{}, err
+	}
+	cfg.IDSalt = envString(set, "ID_SALT", "")
+	if cfg.ObfuscateIDs && cfg.IDSalt == "" {
+		return Config{}, fmt.Errorf("OBFUSCATE_IDS needs ID_SALT, the secret the tokens are derived from")
+	}
+	if cfg.StrictQuery, err = envBool(set, "STRICT_QUERY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.LongPollMaxWait, err = envDuration(set, "LONG_POLL_MAX_WAIT", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.LongPollMaxWait <= 0 {
+		return Config{}, fmt.Errorf("LONG_POLL_MAX_WAIT must be positive, got %s", cfg.LongPollMaxWait)
+	}
+	if cfg.TrustProxy, err = envBool(set, "TRUST_PROXY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.RequestID, err = loadRequestIDConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Gzip, err = loadGzipConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.AdminShutdown, err = envBool(set, "ADMIN_SHUTDOWN", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StoreRetry, err = loadRetryConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.Chaos, err = loadChaosConfig(set); err != nil {
+		return Config{}, err
+	}
+	if cfg.BodyLog, err = loadBodyLogConfig(set); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Settings = set
+	return cfg, nil
+}
+
+func loadCORSConfig(set settingSet) (CORSConfig, error) {
+	c := CORSConfig{
+		AllowedOrigins: envList(set, "CORS_ALLOWED_ORIGINS", nil),
+		AllowedMethods: envList(set, "CORS_ALLOWED_METHODS", []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}),
+		AllowedHeaders: envList(set, "CORS_ALLOWED_HEADERS", []string{"Content-Type"}),
+	}
+	var err error
+	if c.MaxAge, err = envInt(set, "CORS_MAX_AGE", 0); err != nil {
+		return CORSConfig{}, err
+	}
+	if c.MaxAge < 0 {
+		return CORSConfig{}, fmt.Errorf("CORS_MAX_AGE must not be negative, got %d", c.MaxAge)
+	}
+	if c.AllowCredentials, err = envBool(set, "CORS_ALLOW_CREDENTIALS", false); err != nil {
+		return CORSConfig{}, err
+	}
+	if c.AllowCredentials && c.allowsAnyOrigin() {
+		return CORSConfig{}, fmt.Errorf("CORS_ALLOW_CREDENTIALS cannot be combined with a wildcard CORS_ALLOWED_ORIGINS")
+	}
+	return c, nil
+}
+
+func loadQuotaConfig(set settingSet) (QuotaConfig, error) {
+	var (
+		c   QuotaConfig
+		err error
+	)
+	if c.Keys, err = parseQuotas(envList(set, "API_KEY_QUOTAS", nil)); err != nil {
+		return QuotaConfig{}, fmt.Errorf("invalid API_KEY_QUOTAS: %w", err)
+	}
+	ipQuota := envString(set, "IP_QUOTA", "0:0")
+	requests, bytes, ok := strings.Cut(ipQuota, ":")
+	if !ok {
+		return QuotaConfig{}, fmt.Errorf("invalid IP_QUOTA %q, expected requests:bytes", ipQuota)
+	}
+	if c.PerIP, err = parseQuota(requests, bytes); err != nil {
+		return QuotaConfig{}, fmt.Errorf("invalid IP_QUOTA: %w", err)
+	}
+	if c.MaxAddresses, err = envInt(set, "IP_QUOTA_MAX_ADDRESSES", 10000); err != nil {
+		return QuotaConfig{}, err
+	}
+	if c.MaxAddresses < 1 {
+		return QuotaConfig{}, fmt.Errorf("IP_QUOTA_MAX_ADDRESSES must be positive, got %d", c.MaxAddresses)
+	}
+	if c.Period, err = envDuration(set, "QUOTA_PERIOD", 24*time.Hour); err != nil {
+		return QuotaConfig{}, err
+	}
+	if c.Period <= 0 {
+		return QuotaConfig{}, fmt.Errorf("QUOTA_PERIOD must be positive, got %s", c.Period)
+	}
+	c.Headers = RateLimitHeaders{
+		Limit:     envString(set, "RATELIMIT_LIMIT_HEADER", "X-RateLimit-Limit"),
+		Remaining: envString(set, "RATELIMIT_REMAINING_HEADER", "X-RateLimit-Remaining"),
+		Reset:     envString(set, "RATELIMIT_RESET_HEADER", "X-RateLimit-Reset"),
+	}
+	for _, h := range []struct{ env, name string }{
+		{"RATELIMIT_LIMIT_HEADER", c.Headers.Limit},
+		{"RATELIMIT_REMAINING_HEADER", c.Headers.Remaining},
+		{"RATELIMIT_RESET_HEADER", c.Headers.Reset},
+	} {
+		if !validHeaderName(h.name) {
+			return QuotaConfig{}, fmt.Errorf("%s must be a header name, got %q", h.env, h.name)
+		}
+	}
+	return c, nil
+}
+
+func loadEventConfig(set settingSet) (EventConfig, error) {
+	c := EventConfig{WebhookURLs: envList(set, "WEBHOOK_URLS", nil)}
+	var err error
+	if c.QueueSize, err = envInt(set, "EVENT_QUEUE_SIZE", 1000); err != nil {
+		return EventConfig{}, err
+	}
+	if c.QueueSize < 1 {
+		return EventConfig{}, fmt.Errorf("EVENT_QUEUE_SIZE must be positive, got %d", c.QueueSize)
+	}
+	if c.Workers, err = envInt(set, "EVENT_WORKERS", 4); err != nil {
+		return EventConfig{}, err
+	}
+	if c.Workers < 1 {
+		return EventConfig{}, fmt.Errorf("EVENT_WORKERS must be positive, got %d", c.Workers)
+	}
+	switch c.Policy = envString(set, "EVENT_QUEUE_POLICY", queueDropNew); c.Policy {
+	case queueDropNew, queueDropOldest, queueBlock:
+	default:
+		return EventConfig{}, fmt.Errorf("invalid EVENT_QUEUE_POLICY %q, expected drop-new, drop-oldest or block", c.Policy)
+	}
+	if c.BlockTimeout, err = envDuration(set, "EVENT_BLOCK_TIMEOUT", 100*time.Millisecond); err != nil {
+		return EventConfig{}, err
+	}
+	if c.BlockTimeout <= 0 {
+		return EventConfig{}, fmt.Errorf("EVENT_BLOCK_TIMEOUT must be positive, got %s", c.BlockTimeout)
+	}
+	if c.WebhookTimeout, err = envDuration(set, "WEBHOOK_TIMEOUT", 5*time.Second); err != nil {
+		return EventConfig{}, err
+	}
+	if c.WebhookTimeout <= 0 {
+		return EventConfig{}, fmt.Errorf("WEBHOOK_TIMEOUT must be positive, got %s", c.WebhookTimeout)
+	}
+	if c.MaxAttempts, err = envInt(set, "WEBHOOK_MAX_ATTEMPTS", 5); err != nil {
+		return EventConfig{}, err
+	}
+	if c.MaxAttempts < 1 {
+		return EventConfig{}, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", c.MaxAttempts)
+	}
+	if c.BackoffBase, err = envDuration(set, "WEBHOOK_BACKOFF_BASE", 500*time.Millisecond); err != nil {
+		return EventConfig{}, err
+	}
+	if c.BackoffBase <= 0 {
+		return EventConfig{}, fmt.Errorf("WEBHOOK_BACKOFF_BASE must be positive, got %s", c.BackoffBase)
+	}
+	if c.BackoffMax, err = envDuration(set, "WEBHOOK_BACKOFF_MAX", 30*time.Second); err != nil {
+		return EventConfig{}, err
+	}
+	if c.BackoffMax < c.BackoffBase {
+		return EventConfig{}, fmt.Errorf("WEBHOOK_BACKOFF_MAX must not be less than WEBHOOK_BACKOFF_BASE, got %s", c.BackoffMax)
+	}
+	return c, nil
+}
+
+func loadReplicaConfig(set settingSet) (ReplicaConfig, error) {
+	var (
+		c   ReplicaConfig
+		err error
+	)
+	if c.Enabled, err = envBool(set, "READ_REPLICA", false); err != nil {
+		return ReplicaConfig{}, err
+	}
+	if c.Refresh, err = envDuration(set, "READ_REPLICA_REFRESH", time.Second); err != nil {
+		return ReplicaConfig{}, err
+	}
+	if c.Refresh < 0 {
+		return ReplicaConfig{}, fmt.Errorf("READ_REPLICA_REFRESH must not be negative, got %s", c.Refresh)
+	}
+	return c, nil
+}
+
+func loadPersistConfig(set settingSet) (PersistConfig, error) {
+	c := PersistConfig{Path: envString(set, "DATA_FILE", "")}
+	switch mode := envString(set, "PERSIST_MODE", "write-through"); mode {
+	case "write-through":
+	case "write-behind":
+		c.WriteBehind = true
+	default:
+		return PersistConfig{}, fmt.Errorf("invalid PERSIST_MODE %q, expected write-through or write-behind", mode)
+	}
+	var err error
+	if c.Interval, err = envDuration(set, "PERSIST_INTERVAL", time.Second); err != nil {
+		return PersistConfig{}, err
+	}
+	if c.Interval <= 0 {
+		return PersistConfig{}, fmt.Errorf("PERSIST_INTERVAL must be positive, got %s", c.Interval)
+	}
+	if c.AsyncLoad, err = envBool(set, "PERSIST_ASYNC_LOAD", false); err != nil {
+		return PersistConfig{}, err
+	}
+	if c.BatchSize, err = envInt(set, "PERSIST_BATCH_SIZE", 100); err != nil {
+		return PersistConfig{}, err
+	}
+	if c.BatchSize < 1 {
+		return PersistConfig{}, fmt.Errorf("PERSIST_BATCH_SIZE must be at least 1, got %d", c.BatchSize)
+	}
+	switch onFailure := envString(set, "PERSIST_ON_FAILURE", "fail"); onFailure {
+	case "fail":
+	case "degrade":
+		c.Degrade = true
+	default:
+		return PersistConfig{}, fmt.Errorf("invalid PERSIST_ON_FAILURE %q, expected fail or degrade", onFailure)
+	}
+	if c.RetryInterval, err = envDuration(set, "PERSIST_RETRY_INTERVAL", 5*time.Second); err != nil {
+		return PersistConfig{}, err
+	}
+	if c.RetryInterval <= 0 {
+		return PersistConfig{}, fmt.Errorf("PERSIST_RETRY_INTERVAL must be positive, got %s", c.RetryInterval)
+	}
+	return c, nil
+}
+
+func loadRequestIDConfig(set settingSet) (RequestIDConfig, error) {
+	c := RequestIDConfig{Format: envString(set, "REQUEST_ID_FORMAT", "uuid")}
+	var err error
+	if c.HexLength, err = envInt(set, "REQUEST_ID_HEX_LENGTH", 16); err != nil {
+		return RequestIDConfig{}, err
+	}
+	if c.MaxLength, err = envInt(set, "REQUEST_ID_MAX_LENGTH", 128); err != nil {
+		return RequestIDConfig{}, err
+	}
+	if c.MaxLength < 1 {
+		return RequestIDConfig{}, fmt.Errorf("REQUEST_ID_MAX_LENGTH must be positive, got %d", c.MaxLength)
+	}
+	if _, err := newIDGenerator(c); err != nil {
+		return RequestIDConfig{}, fmt.Errorf("REQUEST_ID_FORMAT: %w", err)
+	}
+	return c, nil
+}
+
+func loadGzipConfig(set settingSet) (GzipConfig, error) {
+	var (
+		c   GzipConfig
+		err error
+	)
+	if c.Enabled, err = envBool(set, "GZIP", false); err != nil {
+		return GzipConfig{}, err
+	}
+	if c.MinSize, err = envInt(set, "GZIP_MIN_SIZE", 1024); err != nil {
+		return GzipConfig{}, err
+	}
+	if c.MinSize < 0 {
+		return GzipConfig{}, fmt.Errorf("GZIP_MIN_SIZE must not be negative, got %d", c.MinSize)
+	}
+	if c.Level, err = envInt(set, "GZIP_LEVEL", gzip.DefaultCompression); err != nil {
+		return GzipConfig{}, err
+	}
+	if c.Level < gzip.HuffmanOnly || c.Level > gzip.BestCompression {
+		return GzipConfig{}, fmt.Errorf("GZIP_LEVEL must be between %d and %d, got %d", gzip.HuffmanOnly, gzip.BestCompression, c.Level)
+	}
+	return c, nil
+}
+
+func loadElementLimits(set settingSet) (ElementLimits, error) {
+	var (
+		l   ElementLimits
+		err error
+	)
+	if l.MaxIDs, err = envInt(set, "MAX_IDS", 1000); err != nil {
+		return ElementLimits{}, err
+	}
+	if l.MaxIDs < 1 {
+		return ElementLimits{}, fmt.Errorf("MAX_IDS must be positive, got %d", l.MaxIDs)
+	}
+	if l.MaxBatchItems, err = envInt(set, "MAX_BATCH_ITEMS", 100000); err != nil {
+		return ElementLimits{}, err
+	}
+	if l.MaxBatchItems < 1 {
+		return ElementLimits{}, fmt.Errorf("MAX_BATCH_ITEMS must be positive, got %d", l.MaxBatchItems)
+	}
+	if l.MaxCSVRows, err = envInt(set, "CSV_VALIDATE_MAX_ROWS", 10000); err != nil {
+		return ElementLimits{}, err
+	}
+	if l.MaxCSVRows < 1 {
+		return ElementLimits{}, fmt.Errorf("CSV_VALIDATE_MAX_ROWS must be positive, got %d", l.MaxCSVRows)
+	}
+	return l, nil
+}
+
+func loadRetryConfig(set settingSet) (RetryConfig, error) {
+	var (
+		c   RetryConfig
+		err error
+	)
+	if c.Attempts, err = envInt(set, "STORE_RETRY_ATTEMPTS", 3); err != nil {
+		return RetryConfig{}, err
+	}
+	if c.Attempts < 1 {
+		return RetryConfig{}, fmt.Errorf("STORE_RETRY_ATTEMPTS must be at least 1, got %d", c.Attempts)
+	}
+	if c.Backoff, err = envDuration(set, "STORE_RETRY_BACKOFF", 50*time.Millisecond); err != nil {
+		return RetryConfig{}, err
+	}
+	if c.Backoff < 0 {
+		return RetryConfig{}, fmt.Errorf("STORE_RETRY_BACKOFF must not be negative, got %s", c.Backoff)
+	}
+	return c, nil
+}
+
+func loadChaosConfig(set settingSet) (ChaosConfig, error) {
+	var (
+		c   ChaosConfig
+		err error
+	)
+	if c.DelayMin, err = envDuration(set, "CHAOS_DELAY_MIN", 0); err != nil {
+		return ChaosConfig{}, err
+	}
+	if c.DelayMax, err = envDuration(set, "CHAOS_DELAY_MAX", 0); err != nil {
+		return ChaosConfig{}, err
+	}
+	if c.DelayMin < 0 || c.DelayMax < c.DelayMin {
+		return ChaosConfig{}, fmt.Errorf("CHAOS_DELAY_MIN and CHAOS_DELAY_MAX must satisfy 0 <= min <= max, got %s and %s", c.DelayMin, c.DelayMax)
+	}
+	if v := envString(set, "CHAOS_ERROR_RATE", ""); v != "" {
+		if c.ErrorRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return ChaosConfig{}, fmt.Errorf("invalid CHAOS_ERROR_RATE %q: %w", v, err)
+		}
+		if c.ErrorRate < 0 || c.ErrorRate > 1 {
+			return ChaosConfig{}, fmt.Errorf("CHAOS_ERROR_RATE must be between 0 and 1, got %g", c.ErrorRate)
+		}
+	}
+	return c, nil
+}
+
+func loadBodyLogConfig(set settingSet) (BodyLogConfig, error) {
+	c := BodyLogConfig{
+		RedactFields: envList(set, "LOG_BODIES_REDACT", []string{"password", "token", "secret", "api_key", "authorization"}),
+	}
+	var err error
+	if c.Enabled, err = envBool(set, "LOG_BODIES", false); err != nil {
+		return BodyLogConfig{}, err
+	}
+	if c.MaxBytes, err = envInt(set, "LOG_BODIES_MAX_BYTES", 4096); err != nil {
+		return BodyLogConfig{}, err
+	}
+	if c.MaxBytes < 1 {
+		return BodyLogConfig{}, fmt.Errorf("LOG_BODIES_MAX_BYTES must be positive, got %d", c.MaxBytes)
+	}
+	return c, nil
+}
+
+// The env helpers note the value they return, or its text, with
+// set, so that Config.Settings lists defaults as well.
+
+func envString(set settingSet, key, def string) string {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		v = def
+	}
+	set.note(key, v)
+	return v
+}
+
+// envList reads a comma-separated list, dropping empty elements.
+func envList(set settingSet, key string, def []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		set.note(key, strings.Join(def, ","))
+		return def
+	}
+	list := splitList(v)
+	set.note(key, strings.Join(list, ","))
+	return list
+}
+
+// splitList splits a comma-separated list, dropping empty elements.
+func splitList(v string) []string {
+	var list []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func envInt(set settingSet, key string, def int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		set.note(key, strconv.Itoa(def))
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	set.note(key, strconv.Itoa(n))
+	return n, nil
+}
+
+func envBool(set settingSet, key string, def bool) (bool, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		set.note(key, strconv.FormatBool(def))
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	set.note(key, strconv.FormatBool(b))
+	return b, nil
+}
+
+func envDuration(set settingSet, key string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		set.note(key, def.String())
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	set.note(key, d.String())
+	return d, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// csvRowResult reports the validation of one CSV row.
+type csvRowResult struct {
+	// Line is the line of the file the row starts on, the header being
+	// line 1.
+	Line   int          `json:"line"`
+	Valid  bool         `json:"valid"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// csvColumns maps the columns of a CSV header to their index. The columns
+// are those of the CSV export; id, created_at and updated_at are accepted
+// so that an export can be checked as it is, but ignored, as the store
+// assigns them.
+func csvColumns(header []string) (map[string]int, error) {
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, c := range csvHeader {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown CSV column %q, expected %s", name, strings.Join(csvHeader, ", "))
+		}
+		if _, dup := cols[name]; dup {
+			return nil, fmt.Errorf("CSV column %q given twice", name)
+		}
+		cols[name] = i
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil, fmt.Errorf("CSV header has no name column")
+	}
+	return cols, nil
+}
+
+// csvItem reads the item of one CSV row, the export format in reverse: an
+// empty value cell means no value, and tags are joined by
+// csvTagSeparator. Cells that do not parse are reported in the returned
+// errors, and left at their zero value in the item so that the other
+// fields can still be validated.
+func csvItem(cols map[string]int, record []string, defaults map[string]int) (Item, []FieldError) {
+	cell := func(col string) string {
+		if i, ok := cols[col]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	var verr ValidationError
+	in := newItem{Item: Item{Name: cell("name"), Category: cell("category")}}
+	if v := strings.TrimSpace(cell("value")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			verr.add("value", "must be an integer, got %q", v)
+		} else {
+			in.Value = &n
+		}
+	}
+	if tags := cell("tags"); tags != "" {
+		in.Tags = strings.Split(tags, csvTagSeparator)
+	}
+	return in.item(defaults), verr.Fields
+}
+
+// csvValidateHandler serves POST /items/import/validate, a dry run of a CSV
+// import: every row is checked like a created item and reported, valid or
+// not, and nothing is stored. Name uniqueness, which depends on the store
+// at import time, is not checked. At most CSV_VALIDATE_MAX_ROWS rows are
+// read; a longer file is refused.
+func (s *Server) csvValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	if err := checkContentType(r, "text/csv"); err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	cr := csv.NewReader(http.MaxBytesReader(w, r.Body, s.cfg.MaxBatchBytes))
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("empty CSV, expected a header line")
+		}
+		writeError(w, http.StatusBadRequest, "invalid CSV: "+err.Error())
+		return
+	}
+	cols, err := csvColumns(header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results := []csvRowResult{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("CSV is larger than %d bytes", tooLarge.Limit))
+				return
+			}
+			writeError(w, http.StatusBadRequest, "invalid CSV: "+err.Error())
+			return
+		}
+		if len(results) == s.cfg.Elements.MaxCSVRows {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("CSV has more than %d rows, split it", s.cfg.Elements.MaxCSVRows))
+			return
+		}
+		line, _ := cr.FieldPos(0)
+		it, fields := csvItem(cols, record, s.cfg.CategoryDefaults)
+		if _, err := s.store.ValidateItem(it); err != nil {
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				s.writeStoreError(w, err)
+				return
+			}
+			fields = append(fields, verr.Fields...)
+		}
+		results = append(results, csvRowResult{Line: line, Valid: len(fields) == 0, Errors: fields})
+	}
+	s.writeList(w, r, results, len(results), nil)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// newItem is the body of a create request. Value shadows Item.Value as a
+// pointer so that an omitted value can be told from an explicit 0.
+type newItem struct {
+	Item
+	Value *int `json:"value"`
+}
+
+// item returns the item to create: the given value if there is one,
+// otherwise the default of its category from defaults, keyed by lowercase
+// category, otherwise 0.
+func (n newItem) item(defaults map[string]int) Item {
+	it := n.Item
+	if n.Value != nil {
+		it.Value = *n.Value
+	} else if v, ok := defaults[strings.ToLower(it.Category)]; ok {
+		it.Value = v
+	}
+	return it
+}
+
+// parseCategoryDefaults parses a comma-separated list of category:value
+// entries. Categories are matched ignoring case, like the category filter.
+func parseCategoryDefaults(entries []string) (map[string]int, error) {
+	defaults := make(map[string]int, len(entries))
+	for _, e := range entries {
+		cat, v, ok := strings.Cut(e, ":")
+		if !ok || cat == "" {
+			return nil, fmt.Errorf("invalid category default %q, expected category:value", e)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxItemValue {
+			return nil, fmt.Errorf("invalid default value %q for category %q, expected 0 to %d", v, cat, maxItemValue)
+		}
+		key := strings.ToLower(cat)
+		if _, dup := defaults[key]; dup {
+			return nil, fmt.Errorf("category %q has several defaults", cat)
+		}
+		defaults[key] = n
+	}
+	return defaults, nil
+}
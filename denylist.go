@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// NameDenyList holds the rules of names items may not use. A rule is a
+// name in which "*" matches any run of characters: "admin" blocks exactly
+// that name, "admin*" every name starting with it and "*admin*" every name
+// containing it. Rules and names are compared after normalization and
+// ignoring case.
+type NameDenyList struct {
+	// static are the rules given in the configuration, path the optional
+	// file adding one rule per line.
+	static []string
+	path   string
+
+	rules atomic.Pointer[[]string]
+}
+
+// NewNameDenyList builds a deny-list from rules and, unless path is empty,
+// the rules of that file.
+func NewNameDenyList(rules []string, path string) (*NameDenyList, error) {
+	d := &NameDenyList{path: path}
+	for _, r := range rules {
+		if r = denyRule(r); r != "" {
+			d.static = append(d.static, r)
+		}
+	}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload re-reads the rules file and swaps in the new rules at once, so
+// that concurrent validations see either the old list or the new one. On
+// error the current rules stay in place.
+func (d *NameDenyList) Reload() error {
+	rules := append([]string(nil), d.static...)
+	if d.path != "" {
+		f, err := os.Open(d.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := sc.Text()
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			if r := denyRule(line); r != "" {
+				rules = append(rules, r)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return fmt.Errorf("reading %s: %w", d.path, err)
+		}
+	}
+	d.rules.Store(&rules)
+	return nil
+}
+
+// Len returns the number of rules in effect.
+func (d *NameDenyList) Len() int {
+	return len(*d.rules.Load())
+}
+
+// Match returns the first rule blocking name, if any. A nil list blocks
+// nothing.
+func (d *NameDenyList) Match(name string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	name = strings.ToLower(normalizeName(name))
+	for _, r := range *d.rules.Load() {
+		if globMatch(r, name) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+func denyRule(r string) string {
+	return strings.ToLower(normalizeName(r))
+}
+
+// globMatch reports whether s matches pattern, in which "*" matches any
+// possibly empty run of characters and every other byte matches itself.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, p)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
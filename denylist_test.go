@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameDenyList(t *testing.T) {
+	deny, err := NewNameDenyList([]string{"admin", " Root* ", "*damn*"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"admin", "admin"},
+		{"ADMIN", "admin"},
+		{"  admin  ", "admin"},
+		{"administrator", ""},
+		{"root", "root*"},
+		{"rootkit", "root*"},
+		{"chroot", ""},
+		{"damn", "*damn*"},
+		{"oh damn it", "*damn*"},
+		{"DAMNATION", "*damn*"},
+		{"widget", ""},
+		{"dam", ""},
+	}
+	for _, tt := range tests {
+		rule, ok := deny.Match(tt.name)
+		if ok != (tt.rule != "") || rule != tt.rule {
+			t.Errorf("Match(%q) = %q, %v, want %q", tt.name, rule, ok, tt.rule)
+		}
+	}
+	if _, ok := (*NameDenyList)(nil).Match("admin"); ok {
+		t.Error("a nil deny-list blocked a name")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"a", "a", true},
+		{"a", "ab", false},
+		{"*", "", true},
+		{"a*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*c", "acb", false},
+		{"a*b*c", "axbyc", true},
+		{"a*b*c", "axcyb", false},
+		{"*aa", "aaa", true},
+		{"aa*aa", "aaa", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestNameDenyListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	if err := os.WriteFile(path, []byte("# reserved\nsystem\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deny, err := NewNameDenyList([]string{"admin"}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deny.Len() != 2 {
+		t.Errorf("got %d rules, want 2", deny.Len())
+	}
+	if err := os.WriteFile(path, []byte("guest\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := deny.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := deny.Match("system"); ok {
+		t.Error("system is still blocked after the reload")
+	}
+	for _, name := range []string{"guest", "admin"} {
+		if _, ok := deny.Match(name); !ok {
+			t.Errorf("%s is not blocked after the reload", name)
+		}
+	}
+	os.Remove(path)
+	if err := deny.Reload(); err == nil {
+		t.Error("reloading a missing file succeeded")
+	}
+	if _, ok := deny.Match("guest"); !ok {
+		t.Error("a failed reload dropped the rules")
+	}
+}
+
+func TestNameDenyListHandlers(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"NAME_DENYLIST": "admin,*spam*"})
+	mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget"}`)
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/items", `{"name":"Admin"}`, http.StatusBadRequest},
+		{http.MethodPost, "/items", `{"name":"no spam here"}`, http.StatusBadRequest},
+		{http.MethodPost, "/items", `{"name":"administrator"}`, http.StatusCreated},
+		{http.MethodPut, "/items/1", `{"name":"admin"}`, http.StatusBadRequest},
+		{http.MethodPut, "/items/1", `{"name":"gadget"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		mustDo(t, h, tt.status, tt.method, tt.path, tt.body)
+	}
+}
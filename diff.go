@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// FieldChange is one field that differs between two items.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// diffItems lists the fields, other than the ID, whose values differ
+// between a and b, in the order of the JSON representation.
+func diffItems(a, b Item) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, before, after any) {
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, FieldChange{Field: field, Before: before, After: after})
+		}
+	}
+	add("name", a.Name, b.Name)
+	add("category", a.Category, b.Category)
+	add("value", a.Value, b.Value)
+	// A nil and an empty tag list are the same thing on the wire.
+	if len(a.Tags) > 0 || len(b.Tags) > 0 {
+		add("tags", nonNilTags(a.Tags), nonNilTags(b.Tags))
+	}
+	if len(a.Metadata) > 0 || len(b.Metadata) > 0 {
+		add("metadata", nonNilMetadata(a.Metadata), nonNilMetadata(b.Metadata))
+	}
+	// Times are compared as instants, whatever their location.
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		changes = append(changes, FieldChange{Field: "created_at", Before: a.CreatedAt, After: b.CreatedAt})
+	}
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		changes = append(changes, FieldChange{Field: "updated_at", Before: a.UpdatedAt, After: b.UpdatedAt})
+	}
+	return changes
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+func nonNilMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return map[string]string{}
+	}
+	return md
+}
+
+// diffHandler serves /items/diff?from=1&to=2, the field-by-field changes
+// turning item from into item to.
+func (s *Server) diffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r, "from", "to") {
+		return
+	}
+	q := r.URL.Query()
+	var ids [2]int
+	for i, key := range []string{"from", "to"} {
+		v := q.Get(key)
+		id, err := s.parseItemID(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid or missing %s item id %q", key, v))
+			return
+		}
+		ids[i] = id
+	}
+	from, err := s.reads.GetItem(ids[0])
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	to, err := s.reads.GetItem(ids[1])
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeData(w, r, http.StatusOK, map[string]any{
+		"from":    s.externalID(from.ID),
+		"to":      s.externalID(to.ID),
+		"changes": diffItems(from, to),
+	}, nil)
+}
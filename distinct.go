@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// DistinctCount is one distinct value of a field and the number of items
+// carrying it.
+type DistinctCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Distinct returns the distinct values of field, category or tags, across
+// all items, sorted, with the number of items carrying each. Items without
+// a category are not counted.
+func (s *MemoryStore) Distinct(field string) ([]DistinctCount, error) {
+	if field != "category" && field != "tags" {
+		var verr ValidationError
+		verr.add("field", "must be category or tags, got %q", field)
+		return nil, &verr
+	}
+
+	s.mu.RLock()
+	counts := make(map[string]int)
+	for _, it := range s.items {
+		if field == "category" {
+			if it.Category != "" {
+				counts[it.Category]++
+			}
+			continue
+		}
+		seen := make(map[string]bool, len(it.Tags))
+		for _, t := range it.Tags {
+			if !seen[t] {
+				seen[t] = true
+				counts[t]++
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	values := make([]DistinctCount, 0, len(counts))
+	for v, n := range counts {
+		values = append(values, DistinctCount{Value: v, Count: n})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Value < values[j].Value })
+	return values, nil
+}
+
+// distinctHandler serves /items/distinct?field=category, the values of a
+// field in use, for building filters. ?with_counts=true adds the number
+// of items per value.
+func (s *Server) distinctHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r, "field", "with_counts") {
+		return
+	}
+	q := r.URL.Query()
+	withCounts := false
+	if v := q.Get("with_counts"); v != "" {
+		var err error
+		if withCounts, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid with_counts %q", v))
+			return
+		}
+	}
+	values, err := s.reads.Distinct(q.Get("field"))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	if withCounts {
+		s.writeList(w, r, values, len(values), nil)
+		return
+	}
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = v.Value
+	}
+	s.writeList(w, r, names, len(names), nil)
+}
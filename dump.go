@@ -0,0 +1,328 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DumpManifest describes the items of a dump so that an import can tell a
+// complete, unaltered file from a truncated or edited one.
+type DumpManifest struct {
+	// SHA256 is the hex checksum of the canonical form of the items, see
+	// itemsChecksum.
+	SHA256     string    `json:"sha256"`
+	Count      int       `json:"count"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Dump is the document served by GET /admin/export and accepted by
+// POST /admin/import.
+type Dump struct {
+	Manifest DumpManifest `json:"manifest"`
+	Items    []DumpItem   `json:"items"`
+}
+
+// DumpItem is an item of a dump. Its ID is written as clients see it, a
+// token when IDs are obfuscated, and kept as it is read: it is covered by
+// the checksum, but import assigns fresh IDs, so it need not decode.
+type DumpItem struct {
+	Item
+	ID json.RawMessage `json:"id"`
+}
+
+func (d DumpItem) MarshalJSON() ([]byte, error) {
+	id := d.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return marshalWithID(d.Item, id)
+}
+
+// dumpItems returns the items of a dump of items.
+func (s *Server) dumpItems(items []Item) ([]DumpItem, error) {
+	out := make([]DumpItem, len(items))
+	for i, it := range items {
+		id, err := json.Marshal(s.externalID(it.ID))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = DumpItem{Item: it, ID: id}
+	}
+	return out, nil
+}
+
+// itemsChecksum hashes the canonical form of items: each one encoded as
+// compact JSON by encoding/json, which writes struct fields in a fixed
+// order and map keys sorted, followed by a newline. The hash covers the
+// decoded values rather than the bytes of the file, so re-indenting a dump
+// keeps it valid while changing any value does not.
+func itemsChecksum(items []DumpItem) (string, error) {
+	h := sha256.New()
+	for _, it := range items {
+		b, err := json.Marshal(it)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// adminExportHandler serves GET /admin/export, a dump of every item, by
+// ID, with its manifest.
+func (s *Server) adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	if !checkAccept(w, r, "application/json") {
+		return
+	}
+	items, err := s.dumpItems(s.store.GetItems())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum, err := itemsChecksum(items)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="dump.json"`)
+	writeJSON(w, http.StatusOK, Dump{
+		Manifest: DumpManifest{SHA256: sum, Count: len(items), ExportedAt: time.Now().UTC()},
+		Items:    items,
+	})
+}
+
+// adminImportHandler serves POST /admin/import, which adds the items of a
+// dump once its manifest checks out. The items are added in one
+// transaction, so an invalid item leaves the store untouched, and with
+// If-Generation-Match only into a store that has not changed. Like seeding,
+// import assigns fresh IDs and timestamps.
+func (s *Server) adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	gen, conditional, err := ifGenerationMatch(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkContentType(r, "application/json"); err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	// Dumps are bounded by the batch limit: they are typically far larger
+	// than a single item and too large for the JSON token limit.
+	var dump Dump
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxBatchBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&dump); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed dump: "+describeDecodeError(err).Error())
+		return
+	}
+	if len(dump.Items) > s.cfg.Elements.MaxBatchItems {
+		writeError(w, http.StatusRequestEntityTooLarge, s.cfg.Elements.tooManyItems().Error())
+		return
+	}
+	if dump.Manifest.SHA256 == "" {
+		writeError(w, http.StatusBadRequest, "dump has no manifest checksum")
+		return
+	}
+	if dump.Manifest.Count != len(dump.Items) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("dump manifest counts %d items, found %d", dump.Manifest.Count, len(dump.Items)))
+		return
+	}
+	sum, err := itemsChecksum(dump.Items)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if sum != dump.Manifest.SHA256 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("dump checksum mismatch: manifest has %s, items hash to %s", dump.Manifest.SHA256, sum))
+		return
+	}
+
+	err = s.store.WithTransaction(func(tx Tx) error {
+		if conditional {
+			if err := checkGeneration(tx, gen); err != nil {
+				return err
+			}
+		}
+		for i, it := range dump.Items {
+			if _, err := tx.AddItem(it.Item); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"imported": len(dump.Items)})
+}
+
+// storeFingerprint combines the hashes of the canonical form of items,
+// encoded as by itemsChecksum, with XOR, so that the result does not depend
+// on their order. Items are distinct, their IDs at least, so none cancel
+// out. With contentOnly the ID and timestamps are left out of each item,
+// which compares stores whose items were imported, and thus renumbered, from
+// one another; identical items then do cancel out in pairs. The count is
+// hashed in last, so that an empty store is told apart.
+func storeFingerprint(items []Item, contentOnly bool) (string, error) {
+	fp := fingerprint{contentOnly: contentOnly}
+	for _, it := range items {
+		if err := fp.add(it); err != nil {
+			return "", err
+		}
+	}
+	return fp.sum(), nil
+}
+
+// fingerprint computes a storeFingerprint one item at a time, for streams.
+type fingerprint struct {
+	contentOnly bool
+	acc         [sha256.Size]byte
+	n           int
+}
+
+func (f *fingerprint) add(it Item) error {
+	if f.contentOnly {
+		it.ID, it.CreatedAt, it.UpdatedAt = 0, time.Time{}, time.Time{}
+	}
+	b, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	for i := range f.acc {
+		f.acc[i] ^= sum[i]
+	}
+	f.n++
+	return nil
+}
+
+func (f *fingerprint) sum() string {
+	h := sha256.New()
+	h.Write(f.acc[:])
+	fmt.Fprintf(h, "%d", f.n)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// adminFingerprintHandler serves GET /admin/fingerprint, a hash of the
+// whole store that two deployments holding the same items share. With
+// ?content=true it ignores IDs and timestamps.
+func (s *Server) adminFingerprintHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r, "content") {
+		return
+	}
+	contentOnly := false
+	if v := r.URL.Query().Get("content"); v != "" {
+		var err error
+		if contentOnly, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid content %q", v))
+			return
+		}
+	}
+	gen := s.store.Generation()
+	items := s.store.GetItems()
+	fp, err := storeFingerprint(items, contentOnly)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"fingerprint": fp,
+		"count":       len(items),
+		"generation":  gen,
+	})
+}
+
+// Trailers of a backup, which are only known once every item is written.
+const (
+	backupFingerprintTrailer = "X-Store-Fingerprint"
+	backupContentTrailer     = "X-Content-Fingerprint"
+	backupCountTrailer       = "X-Item-Count"
+)
+
+// adminBackupHandler serves GET /admin/backup, every item as gzipped JSON
+// lines, streamed from the store through the compressor so that memory
+// stays flat. The fingerprints of the items written, by storeFingerprint
+// with and without IDs and timestamps, and their count are sent as
+// trailers. IDs are written as clients see them, but fingerprinted as they
+// are stored, as by /admin/fingerprint.
+func (s *Server) adminBackupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	if !checkAccept(w, r, "application/gzip") {
+		return
+	}
+	gen := s.reads.Generation()
+	name := fmt.Sprintf("backup-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z"))
+	h := w.Header()
+	h.Set("Content-Type", "application/gzip")
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	h.Set(generationHeader, strconv.FormatUint(gen, 10))
+	h.Set("Trailer", strings.Join([]string{backupFingerprintTrailer, backupContentTrailer, backupCountTrailer}, ", "))
+	w.WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(w)
+	enc := &backupEncoder{itemEncoder: &jsonLinesEncoder{enc: json.NewEncoder(gz), ids: s.ids}, content: fingerprint{contentOnly: true}}
+	if err := s.streamItems(ItemFilter{}, enc); err != nil {
+		// The status line is already sent; without the trailers the
+		// client cannot mistake the truncated file for a backup.
+		errorf("backup: %v", err)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		errorf("backup: %v", err)
+		return
+	}
+	h.Set(backupFingerprintTrailer, enc.full.sum())
+	h.Set(backupContentTrailer, enc.content.sum())
+	h.Set(backupCountTrailer, strconv.Itoa(enc.full.n))
+	infof("backup %s: %d items at generation %d", name, enc.full.n, gen)
+}
+
+// backupEncoder fingerprints the items it encodes.
+type backupEncoder struct {
+	itemEncoder
+	full, content fingerprint
+}
+
+func (e *backupEncoder) Encode(it Item) error {
+	if err := e.full.add(it); err != nil {
+		return err
+	}
+	if err := e.content.add(it); err != nil {
+		return err
+	}
+	return e.itemEncoder.Encode(it)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Sentinel errors returned, usually wrapped with context, by Store
+// implementations. Callers match them with errors.Is.
+var (
+	// ErrNotFound reports that no item has the requested ID.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate reports that an item with the same unique name exists.
+	ErrDuplicate = errors.New("already exists")
+	// ErrConflict reports a request that cannot be applied to the current
+	// state of the store, such as a name matching several items.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation reports an invalid input item. A *ValidationError
+	// matches it.
+	ErrValidation = errors.New("invalid item")
+	// ErrEmpty reports a query that needs at least one stored item.
+	ErrEmpty = errors.New("store is empty")
+	// ErrIDExhausted reports that the ID sequence has run out.
+	ErrIDExhausted = errors.New("item id space exhausted")
+	// ErrNotPersistent is returned by Flush on a store kept in memory only.
+	ErrNotPersistent = errors.New("store is not persistent")
+	// ErrPreconditionFailed reports a conditional write whose condition
+	// does not hold for the current item.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrTransient reports a failure that may go away on retry, such as a
+	// lost connection to a storage backend.
+	ErrTransient = errors.New("temporarily unavailable")
+)
+
+// errorStatus maps a store error to the HTTP status that reports it.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrEmpty):
+		return http.StatusNotFound
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDuplicate), errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrIDExhausted):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrNotPersistent):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrTransient):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeStoreError answers with the status matching err and its message.
+// Transient failures also tell the client when to retry.
+func (s *Server) writeStoreError(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.cfg.StoreRetryAfter.Seconds())))
+	}
+	writeError(w, status, s.externalizeMessage(err.Error()))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// failingStore is a Store whose item reads and deletions fail with err.
+type failingStore struct {
+	Store
+	err error
+}
+
+func (f failingStore) GetItem(id int) (Item, error) { return Item{}, f.err }
+
+func (f failingStore) DeleteItem(id int) error { return f.err }
+
+func TestStoreErrorMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not found", fmt.Errorf("item 1 %w", ErrNotFound), http.StatusNotFound},
+		{"empty", ErrEmpty, http.StatusNotFound},
+		{"validation", &ValidationError{Fields: []FieldError{{Field: "name", Message: "is required"}}}, http.StatusBadRequest},
+		{"duplicate", fmt.Errorf("name %q %w", "a", ErrDuplicate), http.StatusConflict},
+		{"conflict", ErrConflict, http.StatusConflict},
+		{"precondition", ErrPreconditionFailed, http.StatusPreconditionFailed},
+		{"ids exhausted", ErrIDExhausted, http.StatusInsufficientStorage},
+		{"not persistent", ErrNotPersistent, http.StatusNotImplemented},
+		{"transient", fmt.Errorf("backend: connection lost: %w", ErrTransient), http.StatusServiceUnavailable},
+		{"other", errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+	s, _ := newTestServer(t, map[string]string{"STORE_RETRY_AFTER": "7s"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorStatus(tt.err); got != tt.status {
+				t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.status)
+			}
+			store := failingStore{Store: s.store, err: tt.err}
+			h := newServer(s.cfg, store, nil, nil).routes()
+			for _, method := range []string{http.MethodGet, http.MethodDelete} {
+				rec := mustDo(t, h, tt.status, method, "/items/1", "")
+				retry := rec.Header().Get("Retry-After")
+				if tt.status == http.StatusServiceUnavailable && retry != "7" {
+					t.Errorf("%s: got Retry-After %q, want 7", method, retry)
+				} else if tt.status != http.StatusServiceUnavailable && retry != "" {
+					t.Errorf("%s: unexpected Retry-After %q", method, retry)
+				}
+			}
+		})
+	}
+}
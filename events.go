@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types published on store mutations.
+const (
+	eventCreated = "item.created"
+	eventUpdated = "item.updated"
+	eventDeleted = "item.deleted"
+)
+
+// Event describes one committed change of an item.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	ID   int       `json:"id"`
+	// Item is the item after the change; it is nil for deletions.
+	Item *Item `json:"item,omitempty"`
+}
+
+// EventSink delivers events somewhere, such as a webhook endpoint. Deliver
+// is called from the dispatcher workers, concurrently.
+type EventSink interface {
+	Deliver(ev Event) error
+}
+
+// Queue policies applied when the dispatcher queue is full.
+const (
+	queueDropNew    = "drop-new"
+	queueDropOldest = "drop-oldest"
+	queueBlock      = "block"
+)
+
+// EventConfig sizes the event dispatcher and lists the webhooks it
+// delivers to. The dispatcher only subscribes to the event bus when
+// WebhookURLs is set.
+type EventConfig struct {
+	QueueSize int
+	Workers   int
+	// Policy is one of drop-new, drop-oldest and block.
+	Policy string
+	// BlockTimeout bounds how long the block policy holds a write before
+	// dropping its event.
+	BlockTimeout time.Duration
+
+	WebhookURLs    []string
+	WebhookTimeout time.Duration
+	// MaxAttempts bounds the deliveries of one event to one sink. Between
+	// attempts the dispatcher waits a random delay of up to BackoffBase,
+	// doubled on every attempt and capped at BackoffMax.
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// EventDispatcher decouples event production, on the write path, from
+// delivery: it subscribes to the event bus and a fixed pool of workers
+// delivers the queued events to every sink. Failed deliveries are retried
+// with backoff; with several workers, events are not necessarily delivered
+// in order.
+type EventDispatcher struct {
+	cfg   EventConfig
+	sinks []EventSink
+	bus   *EventBus
+	sub   *Subscription
+	wg    sync.WaitGroup
+
+	// stopping is closed by Close to cut retry waits short.
+	stopping  chan struct{}
+	closeOnce sync.Once
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	delivered, failed, retries atomic.Int64
+}
+
+// NewEventDispatcher subscribes to bus with a queue of cfg.QueueSize events
+// and cfg.Policy, and starts cfg.Workers workers delivering to sinks.
+func NewEventDispatcher(cfg EventConfig, bus *EventBus, sinks ...EventSink) *EventDispatcher {
+	d := &EventDispatcher{
+		cfg:   cfg,
+		sinks: sinks,
+		bus:   bus,
+		sub:   bus.Subscribe("webhooks", cfg.QueueSize, cfg.Policy, cfg.BlockTimeout),
+
+		stopping: make(chan struct{}),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	d.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+func (d *EventDispatcher) work() {
+	defer d.wg.Done()
+	for ev := range d.sub.Events() {
+		for _, sink := range d.sinks {
+			d.deliver(sink, ev)
+		}
+	}
+}
+
+// deliver hands ev to sink, retrying with backoff. An event that exhausts
+// its attempts, or whose retry is cut short by shutdown, is written to the
+// log as a dead letter so that it can be replayed by hand.
+func (d *EventDispatcher) deliver(sink EventSink, ev Event) {
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = sink.Deliver(ev); err == nil {
+			d.delivered.Add(1)
+			return
+		}
+		if attempt >= d.cfg.MaxAttempts || !d.wait(d.backoff(attempt)) {
+			break
+		}
+		d.retries.Add(1)
+	}
+	d.failed.Add(1)
+	b, _ := json.Marshal(ev)
+	errorf("dead letter after %d attempts: %v: %s", attempt, err, b)
+}
+
+// backoff returns the delay before retry number attempt, chosen at random
+// up to the exponential bound so that retries of many events spread out
+// instead of hitting a recovering receiver all at once.
+func (d *EventDispatcher) backoff(attempt int) time.Duration {
+	bound := d.cfg.BackoffMax
+	if shift := attempt - 1; shift < 32 && d.cfg.BackoffBase<<shift < bound {
+		bound = d.cfg.BackoffBase << shift
+	}
+	d.randMu.Lock()
+	defer d.randMu.Unlock()
+	return time.Duration(d.rand.Int63n(int64(bound) + 1))
+}
+
+// wait sleeps for delay and reports false if the dispatcher is closed
+// first.
+func (d *EventDispatcher) wait(delay time.Duration) bool {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-d.stopping:
+		return false
+	}
+}
+
+// Close unsubscribes from the bus and waits for the queued events to be
+// delivered. Pending retries are given up and dead-lettered.
+func (d *EventDispatcher) Close() {
+	d.closeOnce.Do(func() {
+		d.bus.Unsubscribe(d.sub)
+		close(d.stopping)
+	})
+	d.wg.Wait()
+}
+
+// EventStats is a point-in-time view of the dispatcher. A queue depth
+// staying close to its capacity means the sinks cannot keep up.
+type EventStats struct {
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Published     int64 `json:"published"`
+	Dropped       int64 `json:"dropped"`
+	Delivered     int64 `json:"delivered"`
+	Failed        int64 `json:"failed"`
+	Retries       int64 `json:"retries"`
+}
+
+func (d *EventDispatcher) Stats() EventStats {
+	return EventStats{
+		QueueDepth:    len(d.sub.queue),
+		QueueCapacity: cap(d.sub.queue),
+		Published:     d.sub.published.Load(),
+		Dropped:       d.sub.dropped.Load(),
+		Delivered:     d.delivered.Load(),
+		Failed:        d.failed.Load(),
+		Retries:       d.retries.Load(),
+	}
+}
+
+// EventStore is a Store decorator publishing an event on bus for every
+// successful mutation.
+type EventStore struct {
+	Store
+	bus *EventBus
+}
+
+func NewEventStore(inner Store, bus *EventBus) *EventStore {
+	return &EventStore{Store: inner, bus: bus}
+}
+
+func (e *EventStore) publish(typ string, it Item) {
+	if !e.bus.Active() {
+		return
+	}
+	ev := Event{Type: typ, Time: time.Now().UTC(), ID: it.ID}
+	if typ != eventDeleted {
+		ev.Item = &it
+	}
+	e.bus.Publish(ev)
+}
+
+func (e *EventStore) AddItem(it Item) (Item, error) {
+	created, err := e.Store.AddItem(it)
+	if err == nil {
+		e.publish(eventCreated, created)
+	}
+	return created, err
+}
+
+func (e *EventStore) AddItemIfNameAbsent(it Item) (Item, bool, error) {
+	got, created, err := e.Store.AddItemIfNameAbsent(it)
+	if err == nil && created {
+		e.publish(eventCreated, got)
+	}
+	return got, created, err
+}
+
+func (e *EventStore) UpdateItem(id int, it Item) (Item, error) {
+	updated, err := e.Store.UpdateItem(id, it)
+	if err == nil {
+		e.publish(eventUpdated, updated)
+	}
+	return updated, err
+}
+
+func (e *EventStore) UpdateItemIf(id int, it Item, precond func(current Item) error) (Item, error) {
+	updated, err := e.Store.UpdateItemIf(id, it, precond)
+	if err == nil {
+		e.publish(eventUpdated, updated)
+	}
+	return updated, err
+}
+
+func (e *EventStore) CopyItem(id int, suffix bool) (Item, error) {
+	created, err := e.Store.CopyItem(id, suffix)
+	if err == nil {
+		e.publish(eventCreated, created)
+	}
+	return created, err
+}
+
+func (e *EventStore) DeleteItem(id int) error {
+	err := e.Store.DeleteItem(id)
+	if err == nil {
+		e.publish(eventDeleted, Item{ID: id})
+	}
+	return err
+}
+
+func (e *EventStore) PopItem(id int) (Item, error) {
+	it, err := e.Store.PopItem(id)
+	if err == nil {
+		e.publish(eventDeleted, it)
+	}
+	return it, err
+}
+
+// Truncate publishes a deletion of every item removed, even when the store
+// fails to persist the change, since the items are gone either way.
+func (e *EventStore) Truncate(keep int) ([]Item, error) {
+	removed, err := e.Store.Truncate(keep)
+	for _, it := range removed {
+		e.publish(eventDeleted, it)
+	}
+	return removed, err
+}
+
+// SwapValues publishes an update of both items, read back after the swap.
+func (e *EventStore) SwapValues(a, b int) error {
+	err := e.Store.SwapValues(a, b)
+	if err != nil || !e.bus.Active() {
+		return err
+	}
+	for _, id := range []int{a, b} {
+		if it, gerr := e.Store.GetItem(id); gerr == nil {
+			e.publish(eventUpdated, it)
+		}
+	}
+	return nil
+}
+
+// UpsertByName publishes one event per upserted item. The items are read
+// back after the batch, so a concurrent change may already show in them.
+func (e *EventStore) UpsertByName(items []Item) ([]UpsertResult, error) {
+	results, err := e.Store.UpsertByName(items)
+	if !e.bus.Active() {
+		return results, err
+	}
+	for _, res := range results {
+		it, gerr := e.Store.GetItem(res.ID)
+		if gerr != nil {
+			continue
+		}
+		typ := eventUpdated
+		if res.Created {
+			typ = eventCreated
+		}
+		e.publish(typ, it)
+	}
+	return results, err
+}
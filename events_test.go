@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEventStoreTruncate(t *testing.T) {
+	newSharded := func() (Store, error) {
+		shards := make([]*MemoryStore, 3)
+		for i := range shards {
+			var err error
+			if shards[i], err = NewMemoryStore(); err != nil {
+				return nil, err
+			}
+		}
+		return NewShardedRouter(1, 1, shards...)
+	}
+	stores := []struct {
+		name string
+		new  func() (Store, error)
+	}{
+		{"memory", func() (Store, error) { return NewMemoryStore() }},
+		{"sharded", newSharded},
+	}
+	tests := []struct {
+		keep int
+		want []int
+	}{
+		{keep: 5, want: nil},
+		{keep: 2, want: []int{1, 2, 3}},
+		{keep: 0, want: []int{1, 2, 3, 4, 5}},
+	}
+	for _, st := range stores {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/keep=%d", st.name, tt.keep), func(t *testing.T) {
+				inner, err := st.new()
+				if err != nil {
+					t.Fatal(err)
+				}
+				bus := NewEventBus()
+				store := NewEventStore(inner, bus)
+				for i := 0; i < 5; i++ {
+					if _, err := store.AddItem(Item{Name: fmt.Sprintf("item-%d", i)}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				sub := bus.Subscribe("test", 10, queueDropNew, 0)
+				removed, err := store.Truncate(tt.keep)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(removed) != len(tt.want) {
+					t.Fatalf("removed %d items, want %d", len(removed), len(tt.want))
+				}
+				for i, id := range tt.want {
+					if removed[i].ID != id {
+						t.Errorf("removed[%d] has id %d, want %d", i, removed[i].ID, id)
+					}
+					select {
+					case ev := <-sub.Events():
+						if ev.Type != eventDeleted || ev.ID != id {
+							t.Errorf("event %d is %s of %d, want %s of %d", i, ev.Type, ev.ID, eventDeleted, id)
+						}
+					case <-time.After(time.Second):
+						t.Fatalf("no event for item %d", id)
+					}
+				}
+				select {
+				case ev := <-sub.Events():
+					t.Errorf("unexpected event %s of %d", ev.Type, ev.ID)
+				default:
+				}
+				if n := store.Len(); n != 5-len(tt.want) {
+					t.Errorf("store holds %d items, want %d", n, 5-len(tt.want))
+				}
+			})
+		}
+	}
+}
+
+func TestEventStoreTruncateNegative(t *testing.T) {
+	inner, err := NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEventStore(inner, NewEventBus()).Truncate(-1); err == nil {
+		t.Error("Truncate(-1) succeeded")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFormats maps the extension of /items/export.<ext> to the content
+// type of the response.
+var exportFormats = map[string]string{
+	"csv":   "text/csv; charset=utf-8",
+	"json":  "application/json",
+	"jsonl": ndjsonType,
+}
+
+var csvHeader = []string{"id", "name", "category", "value", "tags", "created_at", "updated_at"}
+
+// csvTagSeparator joins the tags of an item in its CSV tags column.
+const csvTagSeparator = ";"
+
+// exportHandler streams the items matching the filter query parameters in
+// the format selected by the path extension.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request, format string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r, filterParams...) {
+		return
+	}
+	contentType, ok := exportFormats[format]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unsupported export format %q", format))
+		return
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	if !checkAccept(w, r, mediaType) {
+		return
+	}
+	f, err := parseItemFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f.CaseSensitiveName = s.cfg.CaseSensitiveNames
+
+	// As for listings, the generation is read first so that a concurrent
+	// write can only make the tag look older than the content.
+	etag := s.collectionETag(s.reads.Generation())
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "items."+format))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("Range") != "" {
+		s.serveExportRange(w, r, f, format)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := s.streamItems(f, newItemEncoder(format, w, s.ids)); err != nil {
+		// The status line is already sent, all we can do is stop.
+		warnf("export %s: %v", format, err)
+	}
+}
+
+// serveExportRange answers a Range request on an export. Byte offsets need
+// the whole document, so it is built in memory, unlike full exports, and
+// served by http.ServeContent, which answers 206 or 416. A resuming client
+// sends the ETag back in If-Range and gets the full, current export
+// instead of a mismatched tail if the store changed in between.
+func (s *Server) serveExportRange(w http.ResponseWriter, r *http.Request, f ItemFilter, format string) {
+	var buf bytes.Buffer
+	if err := s.streamItems(f, newItemEncoder(format, &buf, s.ids)); err != nil {
+		warnf("export %s: %v", format, err)
+		writeError(w, http.StatusInternalServerError, "export failed")
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// newItemEncoder returns the encoder of format writing to w. Item IDs are
+// written as clients see them, through ids when they are obfuscated.
+func newItemEncoder(format string, w io.Writer, ids *IDCodec) itemEncoder {
+	switch format {
+	case "csv":
+		return newCSVEncoder(w, ids)
+	case "json":
+		return &jsonArrayEncoder{w: w, ids: ids}
+	default:
+		return &jsonLinesEncoder{enc: json.NewEncoder(w), ids: ids}
+	}
+}
+
+// streamItems encodes the items matching f one at a time. Only the ID list
+// is copied up front, so memory stays flat regardless of the store size.
+func (s *Server) streamItems(f ItemFilter, enc itemEncoder) error {
+	if err := enc.Begin(); err != nil {
+		return err
+	}
+	for _, id := range s.reads.IDs() {
+		it, err := s.reads.GetItem(id)
+		if err != nil {
+			// Deleted since the ID snapshot was taken.
+			continue
+		}
+		if !f.Match(it) {
+			continue
+		}
+		if err := enc.Encode(it); err != nil {
+			return err
+		}
+	}
+	return enc.End()
+}
+
+// itemEncoder writes a sequence of items in one export format.
+type itemEncoder interface {
+	Begin() error
+	Encode(it Item) error
+	End() error
+}
+
+type csvEncoder struct {
+	w   *csv.Writer
+	ids *IDCodec
+}
+
+func newCSVEncoder(w io.Writer, ids *IDCodec) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w), ids: ids}
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvEncoder) Encode(it Item) error {
+	return e.w.Write([]string{
+		e.ids.text(it.ID),
+		it.Name,
+		it.Category,
+		strconv.Itoa(it.Value),
+		strings.Join(it.Tags, csvTagSeparator),
+		it.CreatedAt.Format(time.RFC3339Nano),
+		it.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonArrayEncoder struct {
+	w     io.Writer
+	ids   *IDCodec
+	count int
+}
+
+func (e *jsonArrayEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonArrayEncoder) Encode(it Item) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(e.ids.item(it))
+	if err != nil {
+		return err
+	}
+	e.count++
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonArrayEncoder) End() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+type jsonLinesEncoder struct {
+	enc *json.Encoder
+	ids *IDCodec
+}
+
+func (e *jsonLinesEncoder) Begin() error { return nil }
+
+func (e *jsonLinesEncoder) Encode(it Item) error { return e.enc.Encode(e.ids.item(it)) }
+
+func (e *jsonLinesEncoder) End() error { return nil }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"plain", nil},
+		{"obfuscated", map[string]string{"OBFUSCATE_IDS": "true", "ID_SALT": "test-salt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"ADMIN_TOKEN": "secret"}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			s, h := newTestServer(t, env)
+			id, err := json.Marshal(s.externalID(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3}`)
+			if !strings.HasPrefix(rec.Body.String(), `{"id":`+string(id)+`,`) {
+				t.Fatalf("created item %s, want id %s", rec.Body.String(), id)
+			}
+
+			csv := mustDo(t, h, http.StatusOK, http.MethodGet, "/items/export.csv", "").Body.String()
+			if line := strings.Split(csv, "\n")[1]; !strings.HasPrefix(line, strings.Trim(string(id), `"`)+",") {
+				t.Errorf("csv export row %q does not start with id %s", line, id)
+			}
+			for _, path := range []string{"/items/export.json", "/items/export.jsonl", "/admin/export"} {
+				body := mustDo(t, h, http.StatusOK, http.MethodGet, path, "", "Authorization", "Bearer secret").Body.String()
+				if !strings.Contains(body, `{"id":`+string(id)+`,`) {
+					t.Errorf("%s: id %s not found in %s", path, id, body)
+				}
+				if s.ids != nil && strings.Contains(body, `"id":1,`) {
+					t.Errorf("%s: internal id leaked in %s", path, body)
+				}
+			}
+		})
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"plain", map[string]string{"ADMIN_TOKEN": "secret"}},
+		{"obfuscated", map[string]string{"ADMIN_TOKEN": "secret", "OBFUSCATE_IDS": "true", "ID_SALT": "test-salt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, tt.env)
+			mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3,"tags":["a"]}`)
+			dump := mustDo(t, h, http.StatusOK, http.MethodGet, "/admin/export", "", "Authorization", "Bearer secret").Body.String()
+			rec := mustDo(t, h, http.StatusOK, http.MethodPost, "/admin/import", dump, "Authorization", "Bearer secret")
+			if got := strings.TrimSpace(rec.Body.String()); got != `{"imported":1}` {
+				t.Errorf("import answered %s", got)
+			}
+
+			tampered := strings.Replace(dump, `"value":3`, `"value":4`, 1)
+			rec = mustDo(t, h, http.StatusBadRequest, http.MethodPost, "/admin/import", tampered, "Authorization", "Bearer secret")
+			if !strings.Contains(rec.Body.String(), "checksum mismatch") {
+				t.Errorf("tampered dump answered %s", rec.Body.String())
+			}
+		})
+	}
+}
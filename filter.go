@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ItemFilter narrows a listing down to the items matching every set field.
+type ItemFilter struct {
+	// Name matches items whose name contains it, ignoring case unless
+	// CaseSensitiveName is set.
+	Name              string
+	CaseSensitiveName bool
+	// Category matches items in exactly this category, ignoring case.
+	Category string
+	// Value matches items whose value is exactly this one.
+	Value    *int
+	MinValue *int
+	MaxValue *int
+	// UpdatedSince, unless zero, matches items updated strictly after it.
+	UpdatedSince time.Time
+	// Metadata matches items having every one of these metadata keys set
+	// to exactly the given value.
+	Metadata map[string]string
+}
+
+// metadataParamPrefix prefixes the query parameters filtering on metadata,
+// as in ?meta.team=blue.
+const metadataParamPrefix = "meta."
+
+// parseItemFilter reads the filter query parameters shared by the list and
+// export endpoints.
+func parseItemFilter(q url.Values) (ItemFilter, error) {
+	f := ItemFilter{
+		Name:     q.Get("name"),
+		Category: q.Get("category"),
+	}
+
+	var err error
+	if f.Value, err = parseOptionalInt(q, "value"); err != nil {
+		return ItemFilter{}, err
+	}
+	if f.MinValue, err = parseOptionalInt(q, "min_value"); err != nil {
+		return ItemFilter{}, err
+	}
+	if f.MaxValue, err = parseOptionalInt(q, "max_value"); err != nil {
+		return ItemFilter{}, err
+	}
+	if f.MinValue != nil && f.MaxValue != nil && *f.MinValue > *f.MaxValue {
+		return ItemFilter{}, fmt.Errorf("min_value must not be greater than max_value")
+	}
+	for key := range q {
+		if mk := strings.TrimPrefix(key, metadataParamPrefix); mk != key {
+			if !validMetadataKey(mk) {
+				return ItemFilter{}, fmt.Errorf("invalid metadata key %q", mk)
+			}
+			if f.Metadata == nil {
+				f.Metadata = make(map[string]string)
+			}
+			f.Metadata[mk] = q.Get(key)
+		}
+	}
+	if v := q.Get("updated_since"); v != "" {
+		if f.UpdatedSince, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return ItemFilter{}, fmt.Errorf("invalid updated_since %q, expected an RFC 3339 timestamp", v)
+		}
+	}
+	return f, nil
+}
+
+func parseOptionalInt(q url.Values, key string) (*int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return &n, nil
+}
+
+// Match reports whether it satisfies the filter.
+func (f ItemFilter) Match(it Item) bool {
+	if f.Name != "" {
+		name, sub := it.Name, f.Name
+		if !f.CaseSensitiveName {
+			name, sub = strings.ToLower(name), strings.ToLower(sub)
+		}
+		if !strings.Contains(name, sub) {
+			return false
+		}
+	}
+	if f.Category != "" && !strings.EqualFold(it.Category, f.Category) {
+		return false
+	}
+	if f.Value != nil && it.Value != *f.Value {
+		return false
+	}
+	if f.MinValue != nil && it.Value < *f.MinValue {
+		return false
+	}
+	if f.MaxValue != nil && it.Value > *f.MaxValue {
+		return false
+	}
+	if !f.UpdatedSince.IsZero() && !it.UpdatedAt.After(f.UpdatedSince) {
+		return false
+	}
+	for k, v := range f.Metadata {
+		if got, ok := it.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterItems returns the items matching f, ordered by ID. A category or
+// exact value filter is answered from the index of that field when there
+// is one; otherwise FilterItems scans the sorted view without holding the
+// store lock.
+func (s *MemoryStore) FilterItems(f ItemFilter) []Item {
+	matched, _ := s.FilterItemsContext(context.Background(), f)
+	return matched
+}
+
+// filterCheckEvery is how many items FilterItemsContext scans between two
+// checks of its context.
+const filterCheckEvery = 256
+
+// FilterItemsContext is FilterItems stopping early when ctx is done. It
+// then returns the matches found so far, which are the lowest matching
+// IDs, along with the context error.
+func (s *MemoryStore) FilterItemsContext(ctx context.Context, f ItemFilter) ([]Item, error) {
+	candidates := s.sortedView()
+	indexed := false
+	if f.Category != "" {
+		if items, ok := s.lookupIndex("category", strings.ToLower(f.Category)); ok {
+			candidates, indexed = items, true
+		}
+	}
+	if f.Value != nil && !indexed {
+		if items, ok := s.lookupIndex("value", strconv.Itoa(*f.Value)); ok {
+			candidates = items
+		}
+	}
+	var matched []Item
+	for i, it := range candidates {
+		if i%filterCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return matched, err
+			}
+		}
+		if f.Match(it) {
+			matched = append(matched, it)
+		}
+	}
+	return matched, nil
+}
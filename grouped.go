@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+)
+
+// ItemGroup is the items sharing one category or tag.
+type ItemGroup struct {
+	Count int    `json:"count"`
+	Items []Item `json:"items"`
+}
+
+// Group groups the items, by ID within each group, by field, category or
+// tags, in a single pass. An item appears under each of its distinct tags;
+// items without a category, or without tags, are grouped under none.
+func (s *MemoryStore) Group(field, none string) (map[string]ItemGroup, error) {
+	if field != "category" && field != "tags" {
+		var verr ValidationError
+		verr.add("by", "must be category or tags, got %q", field)
+		return nil, &verr
+	}
+
+	s.mu.RLock()
+	groups := make(map[string]ItemGroup)
+	add := func(key string, it Item) {
+		g := groups[key]
+		g.Items = append(g.Items, it)
+		g.Count++
+		groups[key] = g
+	}
+	for _, it := range s.items {
+		switch {
+		case field == "category" && it.Category != "":
+			add(it.Category, it)
+		case field == "tags" && len(it.Tags) > 0:
+			seen := make(map[string]bool, len(it.Tags))
+			for _, t := range it.Tags {
+				if !seen[t] {
+					seen[t] = true
+					add(t, it)
+				}
+			}
+		default:
+			add(none, it)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, g := range groups {
+		sortItemsByID(g.Items)
+	}
+	return groups, nil
+}
+
+// groupedHandler serves /items/grouped?by=category, every item grouped by
+// category or, with by=tags, by tag, with the size of each group.
+func (s *Server) groupedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r, "by") {
+		return
+	}
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "category"
+	}
+	groups, err := s.reads.Group(by, s.cfg.GroupNoneKey)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	// Group keys are client data, so they sit under "groups" rather than
+	// at the top level, next to the fields of the response.
+	s.writeData(w, r, http.StatusOK, map[string]any{"groups": s.externalize(groups)}, map[string]any{"count": len(groups)})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GzipConfig controls response compression.
+type GzipConfig struct {
+	Enabled bool
+	// MinSize is the body size below which responses are sent as is:
+	// compressing them costs more than the bytes it saves.
+	MinSize int
+	// Level is a compress/gzip level, from gzip.HuffmanOnly to
+	// gzip.BestCompression.
+	Level int
+}
+
+// gzipMiddleware compresses the responses of next for clients accepting
+// gzip. The size of a body is only known once it is written, so each
+// response is buffered until MinSize bytes are written or the handler is
+// done, and only compressed in the first case. Partial content, bodies
+// already encoded and responses flushed early by streaming handlers are
+// left alone.
+func gzipMiddleware(c GzipConfig, next http.Handler) http.Handler {
+	if !c.Enabled {
+		return next
+	}
+	pool := sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, c.Level)
+		return gz
+	}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, minSize: c.MinSize, pool: &pool}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, h := range r.Header.Values("Accept-Encoding") {
+		for _, e := range strings.Split(h, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(e), ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+				continue
+			}
+			q := strings.TrimSpace(params)
+			if v := strings.TrimPrefix(q, "q="); v != q {
+				if f, err := strconv.ParseFloat(v, 64); err == nil && f == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it knows whether to
+// compress it.
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+	pool    *sync.Pool
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		g.buf.Write(p)
+		if g.buf.Len() < g.minSize {
+			return len(p), nil
+		}
+		if err := g.decide(g.compressible()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// compressible reports whether the response can be compressed, judging by
+// its status and headers.
+func (g *gzipWriter) compressible() bool {
+	h := g.Header()
+	switch {
+	case g.status == http.StatusPartialContent, g.status == http.StatusNoContent, g.status == http.StatusNotModified:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	case h.Get("Content-Type") == "application/gzip":
+		// Archives are compressed already.
+		return false
+	}
+	return true
+}
+
+// decide sends the header, compressed or not, followed by the buffered
+// start of the body.
+func (g *gzipWriter) decide(compress bool) error {
+	g.decided = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if compress {
+		g.Header().Set("Content-Encoding", "gzip")
+		g.Header().Del("Content-Length")
+		g.gz = g.pool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+		g.ResponseWriter.WriteHeader(g.status)
+		_, err := g.gz.Write(g.buf.Bytes())
+		return err
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf.Bytes())
+	return err
+}
+
+// Flush sends what is buffered. A response flushed before reaching the
+// threshold is a stream and is sent uncompressed.
+func (g *gzipWriter) Flush() {
+	if !g.decided {
+		_ = g.decide(false)
+	}
+	if g.gz != nil {
+		_ = g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close finishes the response once the handler returns. A body that never
+// reached the threshold is sent as is, with its exact Content-Length.
+func (g *gzipWriter) close() {
+	if !g.decided {
+		if g.status == 0 {
+			// The handler wrote nothing at all.
+			return
+		}
+		if g.status != http.StatusNoContent && g.status != http.StatusNotModified && g.Header().Get("Content-Length") == "" {
+			g.Header().Set("Content-Length", strconv.Itoa(g.buf.Len()))
+		}
+		_ = g.decide(false)
+		return
+	}
+	if g.gz != nil {
+		_ = g.gz.Close()
+		g.pool.Put(g.gz)
+	}
+}
+
+func (g *gzipWriter) Unwrap() http.ResponseWriter { return g.ResponseWriter }
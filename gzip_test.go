@@ -0,0 +1,100 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	small := strings.Repeat("a", 100)
+	large := strings.Repeat("abcdefgh", 1000)
+	tests := []struct {
+		name           string
+		level          int
+		acceptEncoding string
+		body           string
+		status         int
+		contentType    string
+		flush          bool
+		gzipped        bool
+		// length is set when the whole body is known before it is sent,
+		// which gets it an exact Content-Length.
+		length bool
+	}{
+		{name: "small", body: small, length: true},
+		{name: "large", body: large, gzipped: true},
+		{name: "large, best speed", level: gzip.BestSpeed, body: large, gzipped: true},
+		{name: "large, best compression", level: gzip.BestCompression, body: large, gzipped: true},
+		{name: "large, gzip not accepted", acceptEncoding: "identity", body: large},
+		{name: "large, gzip refused", acceptEncoding: "gzip;q=0", body: large},
+		{name: "large partial content", body: large, status: http.StatusPartialContent},
+		{name: "large archive", body: large, contentType: "application/gzip"},
+		{name: "stream flushed below the threshold", body: small, flush: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level := tt.level
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			h := gzipMiddleware(GzipConfig{Enabled: true, MinSize: 1024, Level: level}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ct := tt.contentType
+				if ct == "" {
+					ct = "text/plain"
+				}
+				w.Header().Set("Content-Type", ct)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				io.WriteString(w, tt.body[:len(tt.body)/2])
+				if tt.flush {
+					w.(http.Flusher).Flush()
+				}
+				io.WriteString(w, tt.body[len(tt.body)/2:])
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			ae := tt.acceptEncoding
+			if ae == "" {
+				ae = "gzip, deflate"
+			}
+			req.Header.Set("Accept-Encoding", ae)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tt.gzipped {
+				t.Fatalf("compressed: got %v, want %v", got, tt.gzipped)
+			}
+			body := rec.Body.String()
+			if tt.gzipped {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+				if rec.Body.Len() >= len(tt.body) {
+					t.Errorf("compressed body of %d bytes is not smaller", rec.Body.Len())
+				}
+				if cl := rec.Header().Get("Content-Length"); cl != "" {
+					t.Errorf("compressed response has Content-Length %s", cl)
+				}
+			} else if cl := rec.Header().Get("Content-Length"); tt.length && cl != strconv.Itoa(len(tt.body)) {
+				t.Errorf("got Content-Length %q, want %d", cl, len(tt.body))
+			}
+			if body != tt.body {
+				t.Errorf("got a body of %d bytes, want %d", len(body), len(tt.body))
+			}
+			if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+				t.Error("no Vary: Accept-Encoding")
+			}
+		})
+	}
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Server wires the HTTP handlers to a store.
+type Server struct {
+	cfg   Config
+	store Store
+	// reads serves the reads of GET requests: store itself, or a read
+	// replica of it.
+	reads StoreReader
+	// persister is nil when the store is not saved to disk.
+	persister *FilePersister
+	// events is nil when no event sink is configured.
+	events *EventDispatcher
+	// metrics counts the responses served, for /metrics.
+	metrics *httpMetrics
+	// requestIDs generates the correlation IDs of requests.
+	requestIDs IDGenerator
+	// shutdown, when set, receives the description of who asked for a
+	// shutdown through /admin/shutdown.
+	shutdown chan<- string
+	// disabled holds the endpoints of the disabled capabilities, by method
+	// and path as listed in endpoints.
+	disabled map[string]bool
+	// itemRoutes and idRoutes are the enabled routes below /items/, by
+	// path segment and by action on an item; routes fills them.
+	itemRoutes map[string]http.HandlerFunc
+	idRoutes   map[string]idHandler
+	// ids, when set, obfuscates the item IDs seen by clients.
+	ids *IDCodec
+	// stopping is closed by releaseWaiters to end the pending long polls.
+	stopping chan struct{}
+	stopOnce sync.Once
+	// live holds the settings POST /admin/config changes at runtime;
+	// liveMu serializes the changes.
+	live   atomic.Pointer[liveSettings]
+	liveMu sync.Mutex
+}
+
+func newServer(cfg Config, store Store, persister *FilePersister, events *EventDispatcher) *Server {
+	// loadConfig validated the format; a zero Config gets UUIDs.
+	ids, err := newIDGenerator(cfg.RequestID)
+	if err != nil {
+		ids = uuidGenerator{}
+	}
+	s := &Server{cfg: cfg, store: store, reads: store, persister: persister, events: events, metrics: &httpMetrics{}, requestIDs: ids, stopping: make(chan struct{}), ids: cfg.idCodec()}
+	s.disabled = disabledEndpoints(cfg.DisabledCapabilities)
+	s.live.Store(newLiveSettings(cfg))
+	return s
+}
+
+func (s *Server) routes() http.Handler {
+	// Routes are registered through handle, route and routeID, which leave
+	// out the endpoints of the disabled capabilities. Below /items/, the
+	// routes are keyed by path segment, export. standing for every format,
+	// and by action on an item.
+	export := func(w http.ResponseWriter, r *http.Request) {
+		s.exportHandler(w, r, strings.TrimPrefix(r.URL.Path, "/items/export."))
+	}
+	s.itemRoutes = make(map[string]http.HandlerFunc)
+	for _, rt := range []struct {
+		name, path string
+		h          http.HandlerFunc
+	}{
+		{"", "/items", s.itemsHandler},
+		{"export.", "/items/export.{csv,json,jsonl}", export},
+		{"bulk-upsert-by-name", "/items/bulk-upsert-by-name", s.bulkUpsertByNameHandler},
+		{"batch", "/items/batch", s.batchCreateHandler},
+		{"distinct", "/items/distinct", s.distinctHandler},
+		{"grouped", "/items/grouped", s.groupedHandler},
+		{"import/validate", "/items/import/validate", s.csvValidateHandler},
+		{"histogram", "/items/histogram", s.histogramHandler},
+		{"diff", "/items/diff", s.diffHandler},
+		{"swap", "/items/swap", s.swapHandler},
+		{"validate", "/items/validate", s.validateItemHandler},
+		{"max", "/items/max", func(w http.ResponseWriter, r *http.Request) { s.extremeItemHandler(w, r, s.reads.MaxItem) }},
+		{"min", "/items/min", func(w http.ResponseWriter, r *http.Request) { s.extremeItemHandler(w, r, s.reads.MinItem) }},
+	} {
+		h := s.route(rt.path, rt.h)
+		if h == nil {
+			// Answered as unknown paths are, rather than read as an ID.
+			h = notFound
+		}
+		s.itemRoutes[rt.name] = h
+	}
+	s.idRoutes = make(map[string]idHandler)
+	for _, rt := range []struct {
+		action, path string
+		h            idHandler
+	}{
+		{"", "/items/{id}", s.itemByIDHandler},
+		{"exists", "/items/{id}/exists", s.existsHandler},
+		{"copy", "/items/{id}/copy", s.copyItemHandler},
+		{"pop", "/items/{id}/pop", s.popItemHandler},
+		{"increment", "/items/{id}/increment", s.incrementItemHandler},
+		{"value", "/items/{id}/value", s.valueHandler},
+	} {
+		if h := s.routeID(rt.path, rt.h); h != nil {
+			s.idRoutes[rt.action] = h
+		}
+	}
+
+	mux := http.NewServeMux()
+	s.handle(mux, "/", s.rootHandler)
+	s.handle(mux, "/healthz", s.healthzHandler)
+	s.handle(mux, "/health", s.healthHandler)
+	s.handle(mux, "/postman.json", s.postmanHandler)
+	mux.HandleFunc("/items", s.requireLoaded(s.itemRoutes[""]))
+	mux.HandleFunc("/items/", s.requireLoaded(s.itemHandler))
+	s.handle(mux, "/metrics", s.metricsHandler)
+	s.handle(mux, "/admin/metrics", s.requireAdmin(s.adminMetricsHandler))
+	s.handle(mux, "/admin/backup", s.requireAdmin(s.requireLoaded(s.adminBackupHandler)))
+	s.handle(mux, "/admin/config", s.requireAdmin(s.adminConfigHandler))
+	s.handle(mux, "/admin/export", s.requireAdmin(s.requireLoaded(s.adminExportHandler)))
+	s.handle(mux, "/admin/fingerprint", s.requireAdmin(s.requireLoaded(s.adminFingerprintHandler)))
+	s.handle(mux, "/admin/flush", s.requireAdmin(s.adminFlushHandler))
+	s.handle(mux, "/admin/import", s.requireAdmin(s.requireLoaded(s.adminImportHandler)))
+	s.handle(mux, "/admin/shutdown", s.requireAdmin(s.adminShutdownHandler))
+	s.handle(mux, "/admin/reindex", s.requireAdmin(s.requireLoaded(s.adminReindexHandler)))
+	s.handle(mux, "/admin/truncate", s.requireAdmin(s.requireLoaded(s.adminTruncateHandler)))
+	var h http.Handler = readOnlyMiddleware(s.live.Load, mux)
+	h = corsMiddleware(s.cfg.CORS, quotaMiddleware(s.cfg.Quota, s.quotas, bodyLogMiddleware(s.cfg.BodyLog, namingMiddleware(s.cfg.JSONNaming, h))))
+	h = metricsMiddleware(s.metrics, proxyMiddleware(s.cfg.TrustProxy, chaosMiddleware(s.cfg.Chaos, gzipMiddleware(s.cfg.Gzip, h))))
+	return requestIDMiddleware(s.cfg.RequestID, s.requestIDs, headerLimitMiddleware(s.cfg.MaxHeaders, h))
+}
+
+// itemsHandler serves the collection: listing and creation. Listings can
+// also be rendered as HTML for browsers.
+func (s *Server) itemsHandler(w http.ResponseWriter, r *http.Request) {
+	offered := []string{"application/json"}
+	if r.Method == http.MethodGet {
+		offered = append(offered, "text/html")
+	}
+	if !checkAccept(w, r, offered...) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.listItemsHandler(w, r)
+	case http.MethodPost:
+		s.createItemHandler(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// itemHandler serves everything below /items/.
+func (s *Server) itemHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/items/")
+	// Exports and batches negotiate their own media type.
+	if !strings.HasPrefix(rest, "export.") && rest != "batch" && !checkAccept(w, r, "application/json") {
+		return
+	}
+	name := rest
+	if strings.HasPrefix(rest, "export.") {
+		name = "export."
+	}
+	if h, ok := s.itemRoutes[name]; ok {
+		h(w, r)
+		return
+	}
+
+	idPart, action, _ := strings.Cut(rest, "/")
+	idPart = strings.TrimSpace(idPart)
+	action = strings.Trim(action, "/ ")
+	if idPart == "" {
+		writeError(w, http.StatusBadRequest, "missing item id")
+		return
+	}
+	id, err := s.parseItemID(idPart)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h, ok := s.idRoutes[action]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown item action %q", action))
+		return
+	}
+	h(w, r, id)
+}
+
+// itemByIDHandler serves /items/{id}.
+func (s *Server) itemByIDHandler(w http.ResponseWriter, r *http.Request, id int) {
+	var params []string
+	if r.Method == http.MethodPatch {
+		params = []string{"mask"}
+	}
+	if !s.checkQuery(w, r, params...) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.getItemHandler(w, r, id)
+	case http.MethodPut:
+		s.updateItemHandler(w, r, id)
+	case http.MethodPatch:
+		s.patchItemHandler(w, r, id)
+	case http.MethodDelete:
+		s.deleteItemHandler(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// listItemsHandler lists the items matching the filter parameters. With
+// ?ids=1,2,3 only those items are considered, and with ?as=map the result
+// is an object keyed by ID instead of an array. ?sort= orders the array.
+// With ?wait= and ?since= the listing waits for a change, see longPoll.
+func (s *Server) listItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkQuery(w, r, listParams...) {
+		return
+	}
+	q := r.URL.Query()
+	if q.Has("wait") && !s.longPoll(w, r, q) {
+		return
+	}
+	// Read the generation before the items: if a write lands in between,
+	// the response is tagged as older than it is and merely revalidates.
+	gen := s.reads.Generation()
+	etag := weakETag(s.collectionETag(gen))
+	w.Header().Set(generationHeader, strconv.FormatUint(gen, 10))
+	f, err := parseItemFilter(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f.CaseSensitiveName = s.cfg.CaseSensitiveNames
+	asMap := false
+	switch as := q.Get("as"); as {
+	case "", "list":
+	case "map":
+		asMap = true
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid as %q, expected list or map", as))
+		return
+	}
+	var fields fieldMask
+	if q.Has("fields") {
+		if asMap {
+			writeError(w, http.StatusBadRequest, "fields cannot be combined with as=map")
+			return
+		}
+		if fields, err = parseFields(q.Get("fields")); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	sortSpec := s.cfg.DefaultSort
+	if q.Has("sort") {
+		if asMap {
+			writeError(w, http.StatusBadRequest, "sort cannot be combined with as=map")
+			return
+		}
+		sortSpec = q.Get("sort")
+	}
+	keys, err := parseSort(sortSpec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Both representations share the URL, so the HTML one needs its own
+	// ETag for caches keyed on Vary: Accept. Projections are JSON only.
+	html := !asMap && fields == 0 && prefersHTML(r)
+	if html {
+		etag = strings.TrimSuffix(etag, `"`) + `-html"`
+	}
+	w.Header().Add("Vary", "Accept")
+	s.setCacheHeaders(w)
+	if notModified(w, r, etag) {
+		return
+	}
+
+	var (
+		items   []Item
+		projs   []ItemProjection
+		partial bool
+	)
+	// Projections keep the fields they are sorted on, unencoded.
+	copied := fields | sortFields(keys)
+	if q.Has("ids") {
+		ids, err := s.parseIDList(q.Get("ids"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if fields != 0 {
+			projs = s.reads.GetProjectedByIDs(ids, f, fields, copied)
+		} else {
+			for _, it := range s.reads.GetItemsByIDs(ids) {
+				if f.Match(it) {
+					items = append(items, it)
+				}
+			}
+		}
+	} else {
+		ctx := r.Context()
+		if s.cfg.ListTimeBudget > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.cfg.ListTimeBudget)
+			defer cancel()
+		}
+		var err error
+		if items, err = s.reads.FilterItemsContext(ctx, f); err != nil {
+			if r.Context().Err() != nil {
+				// The client is gone.
+				return
+			}
+			partial = true
+		}
+	}
+	// A partial listing says nothing about the state the ETag names, and
+	// must not be cached.
+	if partial {
+		w.Header().Del("ETag")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set(partialHeader, "true")
+	}
+
+	if html {
+		sortItems(items, keys)
+		s.writeItemsHTML(w, r, items)
+		return
+	}
+	if asMap {
+		byID := make(map[string]Item, len(items))
+		// Keyed by the internal ID; externalize re-keys the map by token.
+		for _, it := range items {
+			byID[strconv.Itoa(it.ID)] = it
+		}
+		meta := map[string]any{"count": len(byID)}
+		if partial {
+			meta["partial"] = true
+		}
+		s.writeData(w, r, http.StatusOK, byID, meta)
+		return
+	}
+	var meta map[string]any
+	if partial {
+		meta = map[string]any{"partial": true}
+	}
+	if fields != 0 {
+		for _, it := range items {
+			projs = append(projs, project(it, fields, copied))
+		}
+		sortProjections(projs, keys)
+		s.writeList(w, r, projs, len(projs), meta)
+		return
+	}
+	sortItems(items, keys)
+	s.writeList(w, r, items, len(items), meta)
+}
+
+// listParams are the query parameters of GET /items, the HTML pages
+// included.
+var listParams = append([]string{"ids", "as", "fields", "sort", "wait", "since", "page", "page_size"}, filterParams...)
+
+// partialHeader marks a listing cut short by LIST_TIME_BUDGET.
+const partialHeader = "X-Partial-Response"
+
+// parseIDList parses a comma-separated list of at most MAX_IDS item IDs.
+func (s *Server) parseIDList(v string) ([]int, error) {
+	var ids []int
+	for _, p := range strings.Split(v, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		id, err := s.parseItemID(p)
+		if err != nil {
+			return nil, fmt.Errorf("%v in ids", err)
+		}
+		if len(ids) == s.cfg.Elements.MaxIDs {
+			return nil, fmt.Errorf("ids lists more than %d IDs", s.cfg.Elements.MaxIDs)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// createItemHandler creates an item. With "X-If-Not-Exists: name" the item
+// is only created if no item has its name yet, answering 409 otherwise.
+func (s *Server) createItemHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkQuery(w, r) {
+		return
+	}
+	cond := r.Header.Get("X-If-Not-Exists")
+	if cond != "" && cond != "name" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported X-If-Not-Exists %q, expected name", cond))
+		return
+	}
+	var in newItem
+	if !s.decodeBody(w, r, &in) {
+		return
+	}
+	it := in.item(s.cfg.CategoryDefaults)
+
+	var (
+		created Item
+		ok      = true
+		err     error
+	)
+	if cond == "name" {
+		created, ok, err = s.store.AddItemIfNameAbsent(it)
+	} else {
+		created, err = s.store.AddItem(it)
+	}
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	if !ok {
+		w.Header().Set("Location", s.itemLocation(created.ID))
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error": fmt.Sprintf("an item named %q already exists", created.Name),
+			"id":    s.externalID(created.ID),
+		})
+		return
+	}
+	w.Header().Set("Location", s.itemLocation(created.ID))
+	w.Header().Set("ETag", itemETag(created))
+	s.writeItemResult(w, r, http.StatusCreated, created)
+}
+
+// validateItemHandler is a dry run of item creation: it answers with the
+// normalized item, or with every validation error, and stores nothing.
+func (s *Server) validateItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	var it Item
+	if !s.decodeBody(w, r, &it) {
+		return
+	}
+	normalized, err := s.store.ValidateItem(it)
+	if err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":  verr.Error(),
+				"fields": verr.Fields,
+			})
+			return
+		}
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeData(w, r, http.StatusOK, normalized, nil)
+}
+
+// extremeItemHandler serves /items/max and /items/min.
+func (s *Server) extremeItemHandler(w http.ResponseWriter, r *http.Request, find func() (Item, error)) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	it, err := find()
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeData(w, r, http.StatusOK, it, nil)
+}
+
+func (s *Server) getItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	var it Item
+	err := s.retryStore(r.Context(), func() (err error) {
+		it, err = s.reads.GetItem(id)
+		return err
+	})
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.setCacheHeaders(w)
+	if notModified(w, r, itemETag(it)) {
+		return
+	}
+	s.writeData(w, r, http.StatusOK, it, nil)
+}
+
+// existsHandler answers whether item id exists with a 200 either way, so
+// probes need neither the item body nor a 404 to interpret.
+func (s *Server) existsHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	s.writeData(w, r, http.StatusOK, map[string]bool{"exists": s.reads.Exists(id)}, nil)
+}
+
+// copyItemHandler duplicates item id. The copy's name gets a " (copy)"
+// suffix unless ?suffix=false is given.
+func (s *Server) copyItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r, "suffix") {
+		return
+	}
+	suffix := true
+	if v := r.URL.Query().Get("suffix"); v != "" {
+		var err error
+		if suffix, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid suffix %q", v))
+			return
+		}
+	}
+	var created Item
+	err := s.store.WithTransaction(func(tx Tx) error {
+		var err error
+		created, err = tx.CopyItem(id, suffix)
+		return err
+	})
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", s.itemLocation(created.ID))
+	s.writeItemResult(w, r, http.StatusCreated, created)
+}
+
+// updateItemHandler replaces item id. With If-Match the update only
+// happens if the item still has one of the given ETags, answering 412
+// otherwise, which prevents lost updates between concurrent clients.
+func (s *Server) updateItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	precond := ifMatch(r)
+	if precond == nil && s.cfg.RequireIfMatch {
+		writeError(w, http.StatusPreconditionRequired, "If-Match is required, send the ETag of the item")
+		return
+	}
+	var it Item
+	if !s.decodeBody(w, r, &it) {
+		return
+	}
+	// Check existence first so an unknown ID answers 404 even when the
+	// body is also invalid.
+	if !s.store.Exists(id) {
+		s.writeStoreError(w, fmt.Errorf("item %d %w", id, ErrNotFound))
+		return
+	}
+	var updated Item
+	cond := precond
+	err := s.retryStore(r.Context(), func() (err error) {
+		updated, err = s.store.UpdateItemIf(id, it, cond)
+		if errors.Is(err, ErrTransient) {
+			if want, verr := s.store.ValidateItem(it); verr == nil {
+				cond = retriedPrecond(precond, want)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", itemETag(updated))
+	s.writeItemResult(w, r, http.StatusOK, updated)
+}
+
+// popItemHandler deletes item id and answers with it, for queue-like
+// consumers: when several pop the same item, one gets it and the others
+// get 404.
+func (s *Server) popItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	it, err := s.store.PopItem(id)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeData(w, r, http.StatusOK, it, nil)
+}
+
+// incrementItemHandler adds ?by= (default 1, may be negative) to the value
+// of item id. The read and the write happen in one transaction, so
+// concurrent increments are never lost.
+func (s *Server) incrementItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r, "by") {
+		return
+	}
+	by := 1
+	if v := r.URL.Query().Get("by"); v != "" {
+		var err error
+		if by, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid by %q", v))
+			return
+		}
+	}
+	var updated Item
+	err := s.store.WithTransaction(func(tx Tx) error {
+		it, err := tx.GetItem(id)
+		if err != nil {
+			return err
+		}
+		if (by > 0 && it.Value > math.MaxInt-by) || (by < 0 && it.Value < math.MinInt-by) {
+			var verr ValidationError
+			verr.add("value", "incrementing %d by %d overflows", it.Value, by)
+			return &verr
+		}
+		it.Value += by
+		updated, err = tx.UpdateItem(id, it)
+		return err
+	})
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", itemETag(updated))
+	s.writeData(w, r, http.StatusOK, updated, nil)
+}
+
+// deleteItemHandler answers 204, or with "Prefer: return=representation"
+// 200 and the deleted item, read and removed in one step by PopItem so
+// that it is exactly what was deleted.
+func (s *Server) deleteItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	// The preference is only applied, and echoed, once the item is gone.
+	pref := preferReturn(r)
+	if pref != "representation" {
+		err := s.retryStore(r.Context(), func() error {
+			return s.store.DeleteItem(id)
+		})
+		if err != nil {
+			s.writeStoreError(w, err)
+			return
+		}
+		if pref != "" {
+			w.Header().Set("Preference-Applied", "return="+pref)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// Not retried: a pop that took effect before failing would be retried
+	// into a 404, and the item lost.
+	it, err := s.store.PopItem(id)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Preference-Applied", "return="+pref)
+	s.writeData(w, r, http.StatusOK, it, nil)
+}
+
+// notFound answers 404, as for any unknown path.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "not found")
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestItemPaths calls itemHandler directly, since ServeMux would redirect
+// the uncleaned paths before they reach it.
+func TestItemPaths(t *testing.T) {
+	s, h := newTestServer(t, nil)
+	mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3}`)
+
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/items/", http.StatusOK, `"name":"widget"`},
+		{"/items/1", http.StatusOK, `"name":"widget"`},
+		{"/items/1/", http.StatusOK, `"name":"widget"`},
+		{"/items/%201%20", http.StatusOK, `"name":"widget"`},
+		{"/items/1/exists/", http.StatusOK, ""},
+		{"/items//", http.StatusBadRequest, "missing item id"},
+		{"/items/%20", http.StatusBadRequest, "missing item id"},
+		{"/items/%20/copy", http.StatusBadRequest, "missing item id"},
+		{"/items/abc", http.StatusBadRequest, `invalid item id \"abc\"`},
+		{"/items/2", http.StatusNotFound, "not found"},
+		{"/items/1/bogus", http.StatusNotFound, `unknown item action \"bogus\"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.itemHandler(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("got %s, want it to contain %s", rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteReturnPreference(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefer  string
+		status  int
+		applied string
+		item    bool
+	}{
+		{"default", "", http.StatusNoContent, "", false},
+		{"minimal", "return=minimal", http.StatusNoContent, "return=minimal", false},
+		{"representation", "return=representation", http.StatusOK, "return=representation", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, nil)
+			mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3,"tags":["a"]}`)
+			var headers []string
+			if tt.prefer != "" {
+				headers = []string{"Prefer", tt.prefer}
+			}
+			rec := mustDo(t, h, tt.status, http.MethodDelete, "/items/1", "", headers...)
+			if got := rec.Header().Get("Preference-Applied"); got != tt.applied {
+				t.Errorf("got Preference-Applied %q, want %q", got, tt.applied)
+			}
+			body := rec.Body.String()
+			if tt.item != strings.Contains(body, `"name":"widget","value":3,"tags":["a"]`) {
+				t.Errorf("got body %q", body)
+			}
+			mustDo(t, h, http.StatusNotFound, http.MethodGet, "/items/1", "")
+			rec = mustDo(t, h, http.StatusNotFound, http.MethodDelete, "/items/1", "", headers...)
+			if got := rec.Header().Get("Preference-Applied"); got != "" {
+				t.Errorf("a 404 DELETE got Preference-Applied %q", got)
+			}
+		})
+	}
+}
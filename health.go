@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// healthProbe reports whether path is one of the health probes, which
+// middlewares that may refuse or delay requests let through: failing them
+// gets the pod restarted.
+func healthProbe(path string) bool {
+	return path == "/healthz" || path == "/health"
+}
+
+// healthzHandler is the liveness probe: it is green as soon as the process
+// serves HTTP, even while the store is still loading.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkQuery(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+// healthHandler reports the service state, including the progress of an
+// asynchronous store load. It answers 503 until the store is ready so it
+// can be used as a readiness probe.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkQuery(w, r) {
+		return
+	}
+	resp := map[string]any{"status": "ok"}
+	status := http.StatusOK
+	if loading, loaded, total := s.loadProgress(); loading {
+		status = http.StatusServiceUnavailable
+		resp["status"] = "loading"
+		resp["loading"] = map[string]int64{"loaded": loaded, "total": total}
+	} else {
+		resp["items"] = s.store.Len()
+	}
+	// A degraded store still serves every request, so it stays ready.
+	if s.persister != nil {
+		if degraded, since, err := s.persister.Degraded(); degraded {
+			resp["status"] = "degraded"
+			resp["persistence"] = map[string]any{
+				"degraded": true,
+				"since":    since,
+				"error":    err.Error(),
+				"pending":  s.persister.Pending(),
+			}
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+func (s *Server) loadProgress() (loading bool, loaded, total int64) {
+	if s.persister == nil {
+		return false, 0, 0
+	}
+	return s.persister.LoadProgress()
+}
+
+// requireLoaded answers 503 on the wrapped routes until the store is
+// loaded.
+func (s *Server) requireLoaded(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loading, loaded, total := s.loadProgress(); loading {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable,
+				"store is loading ("+strconv.FormatInt(loaded, 10)+"/"+strconv.FormatInt(total, 10)+" items)")
+			return
+		}
+		next(w, r)
+	}
+}
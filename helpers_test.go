@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer builds a server as run does, from the environment variables
+// of env on top of the defaults, over an empty in-memory store. The store
+// goes through the locking and event decorators the handlers use.
+func newTestServer(t testing.TB, env map[string]string) (*Server, http.Handler) {
+	t.Helper()
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	opts := []StoreOption{
+		WithUniqueNames(cfg.UniqueNames),
+		WithNameNormalization(cfg.NormalizeNames),
+		WithCaseSensitiveNames(cfg.CaseSensitiveNames),
+		WithItemLimits(cfg.ItemLimits),
+		WithIDSequence(cfg.IDStart, cfg.IDStep),
+		WithIndexes(cfg.IndexFields...),
+	}
+	if len(cfg.NameDenyList) > 0 || cfg.NameDenyListFile != "" {
+		deny, err := NewNameDenyList(cfg.NameDenyList, cfg.NameDenyListFile)
+		if err != nil {
+			t.Fatalf("loading name deny-list: %v", err)
+		}
+		opts = append(opts, WithNameDenyList(deny))
+	}
+	mem, err := NewMemoryStore(opts...)
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	var store Store = NewLockingStore(mem, localLocker{})
+	if cfg.RecordFile != "" {
+		rec, err := NewRecordingStore(store, cfg.RecordFile)
+		if err != nil {
+			t.Fatalf("opening record file: %v", err)
+		}
+		t.Cleanup(func() { rec.Close() })
+		store = rec
+	}
+	store = NewEventStore(store, NewEventBus())
+	s := newServer(cfg, store, nil, nil)
+	return s, s.routes()
+}
+
+// do sends a request to h and returns the recorded response. headers are
+// name, value pairs; a body is sent as JSON.
+func do(t testing.TB, h http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// mustDo is do failing the test unless the response has status want.
+func mustDo(t testing.TB, h http.Handler, want int, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := do(t, h, method, path, body, headers...)
+	if rec.Code != want {
+		t.Fatalf("%s %s: got status %d, want %d: %s", method, path, rec.Code, want, rec.Body.String())
+	}
+	return rec
+}
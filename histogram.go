@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxHistogramBounds bounds the number of bucket bounds of a histogram.
+const maxHistogramBounds = 100
+
+// HistogramBucket counts the items whose value is at least Min and below
+// Max. A nil Min or Max leaves that side open.
+type HistogramBucket struct {
+	Min   *int `json:"min"`
+	Max   *int `json:"max"`
+	Count int  `json:"count"`
+}
+
+// Histogram counts the items by value into the buckets delimited by
+// bounds, which must be strictly increasing. The first bucket holds the
+// values below bounds[0] and the last, the overflow bucket, those at or
+// above the last bound, so len(bounds)+1 buckets are returned. The items
+// are counted in a single pass under the read lock.
+func (s *MemoryStore) Histogram(bounds []int) ([]HistogramBucket, error) {
+	var verr ValidationError
+	switch {
+	case len(bounds) == 0:
+		verr.add("buckets", "must list at least one bound")
+	case len(bounds) > maxHistogramBounds:
+		verr.add("buckets", "must list at most %d bounds, got %d", maxHistogramBounds, len(bounds))
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			verr.add("buckets", "must be strictly increasing, %d follows %d", bounds[i], bounds[i-1])
+			break
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return nil, &verr
+	}
+
+	counts := make([]int, len(bounds)+1)
+	s.mu.RLock()
+	for _, it := range s.items {
+		// The number of bounds not above the value is its bucket.
+		counts[sort.Search(len(bounds), func(i int) bool { return bounds[i] > it.Value })]++
+	}
+	s.mu.RUnlock()
+
+	buckets := make([]HistogramBucket, len(counts))
+	for i := range buckets {
+		buckets[i].Count = counts[i]
+		if i > 0 {
+			buckets[i].Min = &bounds[i-1]
+		}
+		if i < len(bounds) {
+			buckets[i].Max = &bounds[i]
+		}
+	}
+	return buckets, nil
+}
+
+// histogramHandler serves /items/histogram?buckets=0,10,100, the number of
+// items per value range.
+func (s *Server) histogramHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r, "buckets") {
+		return
+	}
+	var bounds []int
+	if v := r.URL.Query().Get("buckets"); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				var verr ValidationError
+				verr.add("buckets", "has an invalid bound %q", p)
+				s.writeStoreError(w, &verr)
+				return
+			}
+			bounds = append(bounds, n)
+		}
+	}
+	buckets, err := s.reads.Histogram(bounds)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeData(w, r, http.StatusOK, buckets, nil)
+}
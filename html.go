@@ -0,0 +1,101 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// htmlPageSize is the default number of rows of an HTML listing page.
+const htmlPageSize = 50
+
+// prefersHTML reports whether the client, typically a browser, would
+// rather get an HTML page than JSON.
+func prefersHTML(r *http.Request) bool {
+	mt, _ := negotiate(r, "application/json", "text/html")
+	return mt == "text/html"
+}
+
+var itemsTable = template.Must(template.New("items").Funcs(template.FuncMap{"join": strings.Join}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Items</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Items</h1>
+<p>{{.Total}} items{{if .Items}}, showing {{.First}} to {{.Last}}{{end}}.</p>
+<table>
+<tr><th>ID</th><th>Name</th><th>Category</th><th>Value</th><th>Tags</th><th>Updated</th></tr>
+{{range .Items}}<tr><td><a href="/items/{{.ID}}">{{.ID}}</a></td><td>{{.Name}}</td><td>{{.Category}}</td><td>{{.Value}}</td><td>{{join .Tags ", "}}</td><td>{{.UpdatedAt.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+<p>{{if .Prev}}<a href="{{.Prev}}">previous</a>{{end}} {{if .Next}}<a href="{{.Next}}">next</a>{{end}}</p>
+</body>
+</html>
+`))
+
+// writeItemsHTML renders items, already filtered and sorted, as an HTML
+// table. The table is paginated with ?page= and ?page_size=, and the
+// previous and next links keep the other query parameters.
+func (s *Server) writeItemsHTML(w http.ResponseWriter, r *http.Request, items []Item) {
+	q := r.URL.Query()
+	page, size := 1, htmlPageSize
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page must be a positive integer")
+			return
+		}
+		page = n
+	}
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page_size must be a positive integer")
+			return
+		}
+		size = n
+	}
+
+	start := len(items)
+	if page-1 <= len(items)/size {
+		start = (page - 1) * size
+	}
+	end := len(items)
+	if size < end-start {
+		end = start + size
+	}
+	link := func(p int) string {
+		lq := url.Values{}
+		for k, v := range q {
+			lq[k] = v
+		}
+		lq.Set("page", strconv.Itoa(p))
+		return "/items?" + lq.Encode()
+	}
+	data := struct {
+		// Items is a []Item, or their external form with obfuscated IDs.
+		Items              any
+		Total, First, Last int
+		Prev, Next         string
+	}{Items: s.externalize(items[start:end]), Total: len(items), First: start + 1, Last: end}
+	if page > 1 {
+		data.Prev = link(page - 1)
+	}
+	if end < len(items) {
+		data.Next = link(page + 1)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := itemsTable.Execute(w, data); err != nil {
+		errorf("rendering items table: %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idAlphabet is Crockford's base32, lowercase: no letters easily misread
+// as digits, and no vowels beyond a and e to spell words with.
+const idAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+var idEncoding = base32.NewEncoding(idAlphabet).WithPadding(base32.NoPadding)
+
+// idRounds is the number of Feistel rounds of IDCodec; four make a keyed
+// permutation indistinguishable from a random one.
+const idRounds = 4
+
+// IDCodec turns internal item IDs into opaque tokens and back. The ID is
+// run through a Feistel network keyed by the salt, a permutation of 64-bit
+// values, and written in base32: every ID gets its own 13-character token,
+// and without the salt consecutive IDs give unrelated tokens.
+type IDCodec struct {
+	key []byte
+}
+
+// NewIDCodec returns the codec keyed by salt. Tokens only decode with the
+// salt that encoded them.
+func NewIDCodec(salt string) *IDCodec {
+	return &IDCodec{key: []byte(salt)}
+}
+
+// Encode returns the token of id.
+func (c *IDCodec) Encode(id int) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], c.permute(uint64(id), false))
+	return idEncoding.EncodeToString(b[:])
+}
+
+// Decode returns the ID of tok, failing for a string that no ID encodes to.
+func (c *IDCodec) Decode(tok string) (int, error) {
+	b, err := idEncoding.DecodeString(tok)
+	if err != nil || len(b) != 8 {
+		return 0, fmt.Errorf("malformed item id %q", tok)
+	}
+	v := c.permute(binary.BigEndian.Uint64(b), true)
+	if v == 0 || v > math.MaxInt {
+		return 0, fmt.Errorf("malformed item id %q", tok)
+	}
+	// The last character carries a spare bit, so two strings can decode to
+	// the same value; only the canonical one is accepted.
+	if c.Encode(int(v)) != tok {
+		return 0, fmt.Errorf("malformed item id %q", tok)
+	}
+	return int(v), nil
+}
+
+func (c *IDCodec) permute(v uint64, inverse bool) uint64 {
+	l, r := uint32(v>>32), uint32(v)
+	for i := 0; i < idRounds; i++ {
+		if inverse {
+			l, r = r^c.round(idRounds-1-i, l), l
+		} else {
+			l, r = r, l^c.round(i, r)
+		}
+	}
+	return uint64(l)<<32 | uint64(r)
+}
+
+func (c *IDCodec) round(i int, half uint32) uint32 {
+	var b [5]byte
+	b[0] = byte(i)
+	binary.BigEndian.PutUint32(b[1:], half)
+	m := hmac.New(sha256.New, c.key)
+	m.Write(b[:])
+	return binary.BigEndian.Uint32(m.Sum(nil))
+}
+
+// idCodec returns the codec of the item IDs clients see, or nil when IDs
+// are not obfuscated.
+func (c Config) idCodec() *IDCodec {
+	if !c.ObfuscateIDs {
+		return nil
+	}
+	return NewIDCodec(c.IDSalt)
+}
+
+// parseItemID reads an item ID from a path or query parameter: a token
+// when IDs are obfuscated, a decimal integer otherwise.
+func (s *Server) parseItemID(v string) (int, error) {
+	if s.ids != nil {
+		return s.ids.Decode(v)
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid item id %q", v)
+	}
+	return id, nil
+}
+
+// externalID is id as clients see it, a token or an integer.
+func (s *Server) externalID(id int) any {
+	if s.ids != nil {
+		return s.ids.Encode(id)
+	}
+	return id
+}
+
+// itemLocation is the URL path of item id.
+func (s *Server) itemLocation(id int) string {
+	return fmt.Sprintf("/items/%v", s.externalID(id))
+}
+
+// externalItem is an Item with its ID replaced by a token.
+type externalItem struct {
+	Item
+	ID string
+}
+
+// MarshalJSON encodes the item as usual, swapping the leading integer ID
+// for the token so that id stays the first field.
+func (e externalItem) MarshalJSON() ([]byte, error) {
+	tok, err := json.Marshal(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	return marshalWithID(e.Item, tok)
+}
+
+// marshalWithID encodes it with id, already encoded, in place of its ID.
+func marshalWithID(it Item, id []byte) ([]byte, error) {
+	b, err := json.Marshal(it)
+	if err != nil {
+		return nil, err
+	}
+	rest := b[len(`{"id":`+strconv.Itoa(it.ID)):]
+	return append(append([]byte(`{"id":`), id...), rest...), nil
+}
+
+// item returns it as clients see it, for encoders that hold the codec
+// rather than the server: an externalItem, or it as it is from a nil codec,
+// when IDs are not obfuscated.
+func (c *IDCodec) item(it Item) any {
+	if c == nil {
+		return it
+	}
+	return externalItem{Item: it, ID: c.Encode(it.ID)}
+}
+
+// text returns id as clients see it, as text.
+func (c *IDCodec) text(id int) string {
+	if c == nil {
+		return strconv.Itoa(id)
+	}
+	return c.Encode(id)
+}
+
+// externalEvent is an Event with the IDs of its item replaced by tokens.
+type externalEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+	Item any       `json:"item,omitempty"`
+}
+
+// event returns ev as clients see it, for the webhooks.
+func (c *IDCodec) event(ev Event) any {
+	if c == nil {
+		return ev
+	}
+	out := externalEvent{Type: ev.Type, Time: ev.Time, ID: c.Encode(ev.ID)}
+	if ev.Item != nil {
+		out.Item = c.item(*ev.Item)
+	}
+	return out
+}
+
+// externalUpsertResult is an UpsertResult with its ID replaced by a token;
+// the outer ID field shadows the embedded one when encoding.
+type externalUpsertResult struct {
+	UpsertResult
+	ID string `json:"id"`
+}
+
+// externalize rewrites the item IDs of a response payload into tokens when
+// IDs are obfuscated. Payloads without item IDs are returned as they are.
+func (s *Server) externalize(data any) any {
+	if s.ids == nil {
+		return data
+	}
+	switch v := data.(type) {
+	case Item:
+		return externalItem{Item: v, ID: s.ids.Encode(v.ID)}
+	case []Item:
+		out := make([]externalItem, len(v))
+		for i, it := range v {
+			out[i] = externalItem{Item: it, ID: s.ids.Encode(it.ID)}
+		}
+		return out
+	case map[string]Item:
+		out := make(map[string]externalItem, len(v))
+		for _, it := range v {
+			tok := s.ids.Encode(it.ID)
+			out[tok] = externalItem{Item: it, ID: tok}
+		}
+		return out
+	case map[string]ItemGroup:
+		out := make(map[string]any, len(v))
+		for k, g := range v {
+			out[k] = struct {
+				Count int `json:"count"`
+				Items any `json:"items"`
+			}{g.Count, s.externalize(g.Items)}
+		}
+		return out
+	case []ItemProjection:
+		out := make([]externalProjection, len(v))
+		for i, p := range v {
+			out[i] = externalProjection{ItemProjection: p, ID: s.ids.Encode(p.ID)}
+		}
+		return out
+	case []UpsertResult:
+		out := make([]externalUpsertResult, len(v))
+		for i, res := range v {
+			out[i] = externalUpsertResult{UpsertResult: res, ID: s.ids.Encode(res.ID)}
+		}
+		return out
+	}
+	return data
+}
+
+// internalizeIDs rewrites the item ID tokens of a request body, the "id"
+// of an object or of the objects of an array, back into internal IDs when
+// IDs are obfuscated, so that clients can send an item back as they read
+// it. A body that does not parse is returned as it is, for the decoder to
+// describe.
+func (s *Server) internalizeIDs(b []byte) ([]byte, error) {
+	if s.ids == nil {
+		return b, nil
+	}
+	if t := bytes.TrimSpace(b); len(t) == 0 || t[0] != '[' {
+		return s.internalizeID(b)
+	}
+	var elems []json.RawMessage
+	if json.Unmarshal(b, &elems) != nil {
+		return b, nil
+	}
+	for i, e := range elems {
+		var err error
+		if elems[i], err = s.internalizeID(e); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return json.Marshal(elems)
+}
+
+// internalizeID is internalizeIDs for a single object. Other values, and
+// objects whose id is not a string, are returned as they are.
+func (s *Server) internalizeID(b []byte) ([]byte, error) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(b, &obj) != nil {
+		return b, nil
+	}
+	var tok string
+	if raw, ok := obj["id"]; !ok || json.Unmarshal(raw, &tok) != nil {
+		return b, nil
+	}
+	id, err := s.ids.Decode(tok)
+	if err != nil {
+		return nil, err
+	}
+	obj["id"] = json.RawMessage(strconv.Itoa(id))
+	return json.Marshal(obj)
+}
+
+// itemRefPattern matches the item IDs quoted in store error messages, such
+// as "item 42 not found". Batch errors locate elements as "item 3: ...",
+// an index rather than an ID, which the trailing space excludes.
+var itemRefPattern = regexp.MustCompile(`\bitem (\d+) `)
+
+// externalizeMessage rewrites the item IDs of an error message into tokens
+// when IDs are obfuscated, so that errors do not reveal them either.
+func (s *Server) externalizeMessage(msg string) string {
+	if s.ids == nil {
+		return msg
+	}
+	return itemRefPattern.ReplaceAllStringFunc(msg, func(m string) string {
+		id, err := strconv.Atoi(strings.TrimSpace(m[len("item "):]))
+		if err != nil {
+			return m
+		}
+		return "item " + s.ids.Encode(id) + " "
+	})
+}
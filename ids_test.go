@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSendBackObfuscatedItem(t *testing.T) {
+	s, h := newTestServer(t, map[string]string{"OBFUSCATE_IDS": "true", "ID_SALT": "test-salt"})
+	mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3,"tags":["a"]}`)
+	path := s.itemLocation(1)
+	item := mustDo(t, h, http.StatusOK, http.MethodGet, path, "").Body.String()
+	if !strings.Contains(item, fmt.Sprintf(`"id":%q`, s.ids.Encode(1))) {
+		t.Fatalf("got %s, want the token of item 1", item)
+	}
+
+	rec := mustDo(t, h, http.StatusOK, http.MethodPut, path, item)
+	if got := rec.Body.String(); !strings.Contains(got, fmt.Sprintf(`"id":%q,"name":"widget"`, s.ids.Encode(1))) {
+		t.Errorf("PUT of the item as read answered %s", got)
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal([]byte(mustDo(t, h, http.StatusOK, http.MethodGet, "/items", "").Body.String()), &list); err != nil {
+		t.Fatal(err)
+	}
+	mustDo(t, h, http.StatusOK, http.MethodPost, "/items/bulk-upsert-by-name", "["+string(list[0])+"]")
+
+	rec = mustDo(t, h, http.StatusBadRequest, http.MethodPut, path, `{"id":"not-a-token","name":"widget"}`)
+	if !strings.Contains(rec.Body.String(), "malformed item id") {
+		t.Errorf("PUT with a bad token answered %s", rec.Body.String())
+	}
+}
+
+func TestInternalizeIDs(t *testing.T) {
+	plain, _ := newTestServer(t, nil)
+	if got, err := plain.internalizeIDs([]byte(`{"id":"x"}`)); err != nil || string(got) != `{"id":"x"}` {
+		t.Errorf("without obfuscation got %s, %v; want the body untouched", got, err)
+	}
+
+	s, _ := newTestServer(t, map[string]string{"OBFUSCATE_IDS": "true", "ID_SALT": "test-salt"})
+	tok := s.ids.Encode(7)
+	tests := []struct {
+		body, want string
+		wantErr    bool
+	}{
+		{body: fmt.Sprintf(`{"id":%q,"value":3.0}`, tok), want: `{"id":7,"value":3.0}`},
+		{body: fmt.Sprintf(`[{"id":%q},{"name":"b"}]`, tok), want: `[{"id":7},{"name":"b"}]`},
+		{body: `{"id":7}`, want: `{"id":7}`},
+		{body: `{"name":`, want: `{"name":`},
+		{body: `{"id":"bogus"}`, wantErr: true},
+		{body: `[{"name":"a"},{"id":"bogus"}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := s.internalizeIDs([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.body, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
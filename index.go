@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// indexKeys extract, for each indexable field, the key an item is indexed
+// under. Keys are in the form filters compare, so an equality filter on
+// the field can be answered by a single lookup.
+var indexKeys = map[string]func(it Item) string{
+	"category": func(it Item) string { return strings.ToLower(it.Category) },
+	"value":    func(it Item) string { return strconv.Itoa(it.Value) },
+}
+
+// WithIndexes maintains a secondary index, from field value to item IDs,
+// for each of fields. Indexes speed up filters on those fields at the
+// cost of some bookkeeping on every write. Names always have an index of
+// their own, used for uniqueness and upserts, but the name filter matches
+// substrings and cannot use it.
+func WithIndexes(fields ...string) StoreOption {
+	return func(s *MemoryStore) error {
+		for _, f := range fields {
+			if _, ok := indexKeys[f]; !ok {
+				return fmt.Errorf("field %q cannot be indexed, expected category or value", f)
+			}
+			if s.indexes == nil {
+				s.indexes = make(map[string]map[string]idSet)
+			}
+			s.indexes[f] = make(map[string]idSet)
+		}
+		return nil
+	}
+}
+
+// indexLocked adds it to the secondary indexes.
+func (s *MemoryStore) indexLocked(it Item) {
+	for field, idx := range s.indexes {
+		key := indexKeys[field](it)
+		if idx[key] == nil {
+			idx[key] = make(idSet)
+		}
+		idx[key][it.ID] = struct{}{}
+	}
+}
+
+// unindexLocked removes it from the secondary indexes.
+func (s *MemoryStore) unindexLocked(it Item) {
+	for field, idx := range s.indexes {
+		key := indexKeys[field](it)
+		delete(idx[key], it.ID)
+		if len(idx[key]) == 0 {
+			delete(idx, key)
+		}
+	}
+}
+
+// resetIndexesLocked empties the secondary indexes, keeping the set of
+// indexed fields.
+func (s *MemoryStore) resetIndexesLocked() {
+	for field := range s.indexes {
+		s.indexes[field] = make(map[string]idSet)
+	}
+}
+
+// lookupIndex returns the items, ordered by ID, indexed under key for
+// field. It reports false if field is not indexed.
+func (s *MemoryStore) lookupIndex(field, key string) ([]Item, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx, ok := s.indexes[field]
+	if !ok {
+		return nil, false
+	}
+	items := make([]Item, 0, len(idx[key]))
+	for id := range idx[key] {
+		items = append(items, s.items[id])
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, true
+}
+
+// FindByValue returns the items whose value is exactly v, ordered by ID,
+// and an empty slice if there are none. It looks them up in the value
+// index when there is one and scans the items otherwise.
+func (s *MemoryStore) FindByValue(v int) ([]Item, error) {
+	items, err := s.FilterItemsContext(context.Background(), ItemFilter{Value: &v})
+	if items == nil {
+		items = []Item{}
+	}
+	return items, err
+}
+
+// Reindex drops every index, the name index included, and rebuilds them
+// from the items under the write lock. It is a safety valve for indexes
+// that drifted from the items, and returns the number of keys of each
+// index once rebuilt.
+func (s *MemoryStore) Reindex() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.names = make(map[string]idSet)
+	s.resetIndexesLocked()
+	for _, it := range s.items {
+		s.putLocked(it)
+	}
+	sizes := map[string]int{"name": len(s.names)}
+	for field, idx := range s.indexes {
+		sizes[field] = len(idx)
+	}
+	return sizes
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// BenchmarkFilterItems measures category and exact value filters over
+// 10000 items, answered from an index and by a scan of the sorted view.
+func BenchmarkFilterItems(b *testing.B) {
+	value := 7
+	filters := []struct {
+		name string
+		f    ItemFilter
+	}{
+		{"category", ItemFilter{Category: "CAT-7"}},
+		{"value", ItemFilter{Value: &value}},
+	}
+	stores := []struct {
+		name string
+		opts []StoreOption
+	}{
+		{"scan", nil},
+		{"indexed", []StoreOption{WithIndexes("category", "value")}},
+	}
+	for _, st := range stores {
+		s := newBenchStore(b, 10000, st.opts...)
+		for _, ft := range filters {
+			b.Run(ft.name+"/"+st.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if items := s.FilterItems(ft.f); len(items) == 0 {
+						b.Fatal("no items matched")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestIndexedFilterMatchesScan(t *testing.T) {
+	scan := newBenchStore(t, 500)
+	indexed := newBenchStore(t, 500, WithIndexes("category", "value"))
+	for _, s := range []*MemoryStore{scan, indexed} {
+		if _, err := s.UpdateItem(8, Item{Name: "moved", Category: "cat-1", Value: 42}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeleteItem(52); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value, other := 42, 999
+	tests := []struct {
+		name string
+		f    ItemFilter
+	}{
+		{"category", ItemFilter{Category: "cat-1"}},
+		{"category ignoring case", ItemFilter{Category: "CAT-7"}},
+		{"missing category", ItemFilter{Category: "missing"}},
+		{"value", ItemFilter{Value: &value}},
+		{"missing value", ItemFilter{Value: &other}},
+		{"category and value", ItemFilter{Category: "cat-1", Value: &value}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, got := itemIDs(scan.FilterItems(tt.f)), itemIDs(indexed.FilterItems(tt.f))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("indexed filter matched %v, the scan %v", got, want)
+			}
+		})
+	}
+}
+
+func itemIDs(items []Item) []int {
+	ids := make([]int, len(items))
+	for i, it := range items {
+		ids[i] = it.ID
+	}
+	return ids
+}
+
+func TestWithIndexesUnknownField(t *testing.T) {
+	if _, err := NewMemoryStore(WithIndexes("name")); err == nil {
+		t.Error("indexing the name field was accepted")
+	}
+}
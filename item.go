@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxNameLength     = 128
+	maxCategoryLength = 64
+	maxItemValue      = 1_000_000_000
+)
+
+// Item is the resource managed by the API.
+type Item struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Category string   `json:"category,omitempty"`
+	Value    int      `json:"value"`
+	Tags     []string `json:"tags,omitempty"`
+	// Metadata holds free-form key/value pairs set by clients.
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// ItemLimits are the configurable bounds enforced by validateItem.
+type ItemLimits struct {
+	MaxTags      int
+	MaxTagLength int
+	// MaxMetadataKeys and MaxMetadataBytes bound the metadata of an item;
+	// the size counts the bytes of every key and value.
+	MaxMetadataKeys  int
+	MaxMetadataBytes int
+	// NameCharset is the policy of the characters allowed in names, one
+	// of nameCharsets.
+	NameCharset string
+}
+
+// DefaultItemLimits are the limits used unless configured otherwise.
+var DefaultItemLimits = ItemLimits{
+	MaxTags:          10,
+	MaxTagLength:     32,
+	MaxMetadataKeys:  16,
+	MaxMetadataBytes: 4096,
+	NameCharset:      charsetPrintable,
+}
+
+// Name character policies.
+const (
+	charsetPrintable    = "printable"
+	charsetPrintableTab = "printable+tab"
+	charsetASCII        = "ascii"
+	charsetAny          = "any"
+)
+
+// nameCharsets maps the name character policies to the test a character
+// must pass and a description for error messages. Only "any" lets control
+// characters, NUL among them, through; every other policy also requires
+// valid UTF-8.
+var nameCharsets = map[string]struct {
+	allowed func(r rune) bool
+	desc    string
+}{
+	// Graphic characters are letters, marks, numbers, punctuation, symbols
+	// and spaces; format characters such as bidirectional overrides are
+	// not.
+	charsetPrintable:    {unicode.IsGraphic, "printable characters and spaces"},
+	charsetPrintableTab: {func(r rune) bool { return r == '\t' || unicode.IsGraphic(r) }, "printable characters, spaces and tabs"},
+	charsetASCII:        {func(r rune) bool { return ' ' <= r && r <= '~' }, "printable ASCII characters"},
+	charsetAny:          {nil, "any characters"},
+}
+
+// checkNameChars returns the description of the first character of name
+// the policy charset rejects, and its byte offset, or "" when there is
+// none.
+func checkNameChars(name, charset string) (string, int) {
+	allowed := nameCharsets[charset].allowed
+	if allowed == nil {
+		return "", 0
+	}
+	for i, r := range name {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(name[i:]); size == 1 {
+				return "invalid UTF-8", i
+			}
+		}
+		if !allowed(r) {
+			return fmt.Sprintf("%U", r), i
+		}
+	}
+	return "", 0
+}
+
+// validMetadataKey reports whether key is made of ASCII letters, digits,
+// '_', '-' and '.', which keeps keys usable in meta.<key> query parameters.
+func validMetadataKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeName trims name and collapses internal runs of whitespace into a
+// single space.
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// FieldError describes why one field of an item is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of an item.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is makes a *ValidationError match ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// trimTags returns a copy of tags with surrounding whitespace removed, so
+// that blank tags are caught by validation and stored items never share
+// their tag slice with the caller.
+func trimTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = strings.TrimSpace(t)
+	}
+	return out
+}
+
+// copyMetadata returns a copy of md, so that stored items never share
+// their metadata map with the caller.
+func copyMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return nil
+	}
+	out := make(map[string]string, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+// sortedKeys returns the keys of md in order, so that validation reports
+// errors deterministically.
+func sortedKeys(md map[string]string) []string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateItem checks the client-controlled fields of an item, its name
+// against deny when it is not nil. It returns a *ValidationError reporting
+// all invalid fields, not just the first one.
+func validateItem(it Item, lim ItemLimits, deny *NameDenyList) error {
+	var verr ValidationError
+	if strings.TrimSpace(it.Name) == "" {
+		verr.add("name", "is required")
+	} else if len(it.Name) > maxNameLength {
+		verr.add("name", "must be at most %d bytes", maxNameLength)
+	} else if bad, at := checkNameChars(it.Name, lim.NameCharset); bad != "" {
+		verr.add("name", "contains %s at byte %d, only %s are allowed", bad, at, nameCharsets[lim.NameCharset].desc)
+	} else if rule, ok := deny.Match(it.Name); ok {
+		verr.add("name", "is not allowed, it matches the deny-list rule %q", rule)
+	}
+	if len(it.Category) > maxCategoryLength {
+		verr.add("category", "must be at most %d bytes", maxCategoryLength)
+	}
+	if it.Value < 0 || it.Value > maxItemValue {
+		verr.add("value", "must be between 0 and %d", maxItemValue)
+	}
+	if len(it.Tags) > lim.MaxTags {
+		verr.add("tags", "must have at most %d entries", lim.MaxTags)
+	}
+	for i, t := range it.Tags {
+		if t == "" {
+			verr.add("tags", "entry %d is empty", i)
+		} else if len(t) > lim.MaxTagLength {
+			verr.add("tags", "entry %d must be at most %d bytes", i, lim.MaxTagLength)
+		}
+	}
+	if len(it.Metadata) > lim.MaxMetadataKeys {
+		verr.add("metadata", "must have at most %d keys", lim.MaxMetadataKeys)
+	}
+	size := 0
+	for _, k := range sortedKeys(it.Metadata) {
+		if !validMetadataKey(k) {
+			verr.add("metadata", "key %q must only contain letters, digits, '_', '-' and '.'", k)
+		}
+		size += len(k) + len(it.Metadata[k])
+	}
+	if size > lim.MaxMetadataBytes {
+		verr.add("metadata", "must be at most %d bytes in total", lim.MaxMetadataBytes)
+	}
+	if len(verr.Fields) > 0 {
+		return &verr
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestItemTagLimits(t *testing.T) {
+	lim := DefaultItemLimits
+	lim.MaxTags = 2
+	lim.MaxTagLength = 4
+	store, err := NewMemoryStore(WithItemLimits(lim))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{"none", nil, ""},
+		{"at the limits", []string{"abcd", "ef"}, ""},
+		{"trimmed to fit", []string{" abcd ", "\tef"}, ""},
+		{"too many", []string{"a", "b", "c"}, "tags must have at most 2 entries"},
+		{"too long", []string{"abcde"}, "tags entry 0 must be at most 4 bytes"},
+		{"empty", []string{"a", ""}, "tags entry 1 is empty"},
+		{"blank", []string{"  "}, "tags entry 0 is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.ValidateItem(Item{Name: "widget", Tags: tt.tags})
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("got error %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want a validation error with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemTagLimitsConfig(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"MAX_TAGS": "1", "MAX_TAG_LENGTH": "3"})
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"name":"a","tags":["abc"]}`, http.StatusCreated},
+		{`{"name":"b","tags":["abc","d"]}`, http.StatusBadRequest},
+		{`{"name":"c","tags":["abcd"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		mustDo(t, h, tt.status, http.MethodPost, "/items", tt.body)
+	}
+}
+
+func TestCheckNameChars(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		bad     string
+		at      int
+	}{
+		{"plain name", charsetPrintable, "", 0},
+		{"café au lait", charsetPrintable, "", 0},
+		{"nul\x00byte", charsetPrintable, "U+0000", 3},
+		{"line\nfeed", charsetPrintable, "U+000A", 4},
+		{"escape\x1b[31m", charsetPrintable, "U+001B", 6},
+		{"del\x7f", charsetPrintable, "U+007F", 3},
+		{"tab\there", charsetPrintable, "U+0009", 3},
+		{"bidi‮override", charsetPrintable, "U+202E", 4},
+		{"bad\xffutf8", charsetPrintable, "invalid UTF-8", 3},
+		{"tab\there", charsetPrintableTab, "", 0},
+		{"line\nfeed", charsetPrintableTab, "U+000A", 4},
+		{"plain name", charsetASCII, "", 0},
+		{"café", charsetASCII, "U+00E9", 3},
+		{"nul\x00byte", charsetAny, "", 0},
+		{"bad\xffutf8", charsetAny, "", 0},
+	}
+	for _, tt := range tests {
+		bad, at := checkNameChars(tt.name, tt.charset)
+		if bad != tt.bad || at != tt.at {
+			t.Errorf("checkNameChars(%q, %s) = %q, %d, want %q, %d", tt.name, tt.charset, bad, at, tt.bad, tt.at)
+		}
+	}
+}
+
+func TestNameCharsetConfig(t *testing.T) {
+	tests := []struct {
+		env    map[string]string
+		body   string
+		status int
+	}{
+		{nil, `{"name":"nul\u0000byte"}`, http.StatusBadRequest},
+		{nil, `{"name":"tab\there"}`, http.StatusCreated},
+		{map[string]string{"NORMALIZE_NAMES": "false"}, `{"name":"tab\there"}`, http.StatusBadRequest},
+		{map[string]string{"NORMALIZE_NAMES": "false", "NAME_CHARSET": "printable+tab"}, `{"name":"tab\there"}`, http.StatusCreated},
+		{map[string]string{"NAME_CHARSET": "ascii"}, `{"name":"caf\u00e9"}`, http.StatusBadRequest},
+		{map[string]string{"NAME_CHARSET": "any"}, `{"name":"nul\u0000byte"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		_, h := newTestServer(t, tt.env)
+		rec := mustDo(t, h, tt.status, http.MethodPost, "/items", tt.body)
+		if tt.status == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "at byte 3") {
+			t.Errorf("%v, %s: error %s does not locate the character", tt.env, tt.body, rec.Body.String())
+		}
+	}
+	t.Setenv("NAME_CHARSET", "latin1")
+	if _, err := loadConfig(); err == nil {
+		t.Error("NAME_CHARSET=latin1 was accepted")
+	}
+}
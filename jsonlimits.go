@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONLimits bound the structure of request bodies, on top of their size:
+// a small body can still nest deeply or hold a huge number of tiny values,
+// both of which are expensive to decode.
+type JSONLimits struct {
+	// MaxDepth bounds the nesting of arrays and objects.
+	MaxDepth int
+	// MaxTokens bounds the number of tokens: delimiters, keys and values.
+	MaxTokens int
+}
+
+// check reports the first limit b exceeds. A syntax error is not reported
+// here but left to the decoding that follows, which describes it better.
+func (l JSONLimits) check(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	depth, tokens := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if tokens++; tokens > l.MaxTokens {
+			return fmt.Errorf("JSON has more than %d tokens", l.MaxTokens)
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			if depth++; depth > l.MaxDepth {
+				return fmt.Errorf("JSON is nested deeper than %d levels", l.MaxDepth)
+			}
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
+}
+
+// decode checks b against the limits and decodes it into v, rejecting
+// unknown fields. Field names are accepted in camelCase as well as
+// snake_case, whatever the convention of the responses.
+func (l JSONLimits) decode(b []byte, v any) error {
+	if err := l.check(b); err != nil {
+		return err
+	}
+	// A body that does not parse is left to the decoder to describe.
+	if renamed, err := renameKeys(b, snakeCase); err == nil {
+		b = renamed
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("trailing data after the JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ElementLimits bound the number of elements a request can carry once it
+// is parsed. They complement the body size limits: a body well within
+// MAX_BATCH_BYTES can still hold millions of small items, and a query
+// string thousands of IDs.
+type ElementLimits struct {
+	// MaxIDs caps the IDs of ?ids=.
+	MaxIDs int
+	// MaxBatchItems caps the items of a batch import, a bulk upsert or an
+	// admin import.
+	MaxBatchItems int
+	// MaxCSVRows caps the rows of a CSV validation request.
+	MaxCSVRows int
+}
+
+// tooManyItems is the error of a batch past MaxBatchItems.
+func (l ElementLimits) tooManyItems() error {
+	return fmt.Errorf("batch has more than %d items, split it", l.MaxBatchItems)
+}
+
+// headerLimitMiddleware answers 431 to requests with more than max header
+// fields, counting every value of a repeated field. The size of the headers
+// is bounded by the server itself, see Config.MaxHeaderBytes, but many
+// small fields fit in it, each one costing a map entry and the attention of
+// every middleware that scans them.
+func headerLimitMiddleware(max int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 0
+		for _, values := range r.Header {
+			n += len(values)
+		}
+		if n > max {
+			writeError(w, http.StatusRequestHeaderFieldsTooLarge, fmt.Sprintf("request has %d header fields, at most %d are accepted", n, max))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// jsonItems returns a JSON array of n items named prefix-0, prefix-1 and
+// so on.
+func jsonItems(prefix string, n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"name":"%s-%d","value":%d}`, prefix, i, i)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestElementLimits(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{
+		"MAX_IDS":               "3",
+		"MAX_BATCH_ITEMS":       "2",
+		"CSV_VALIDATE_MAX_ROWS": "2",
+		"ADMIN_TOKEN":           "secret",
+	})
+	mustDo(t, h, http.StatusOK, http.MethodPost, "/items/bulk-upsert-by-name", jsonItems("seed", 2))
+	mustDo(t, h, http.StatusOK, http.MethodPost, "/items/bulk-upsert-by-name", jsonItems("more", 1))
+	dump := mustDo(t, h, http.StatusOK, http.MethodGet, "/admin/export", "", "Authorization", "Bearer secret").Body.String()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers []string
+		status  int
+	}{
+		{"ids at the limit", http.MethodGet, "/items?ids=1,2,3", "", nil, http.StatusOK},
+		{"ids past the limit", http.MethodGet, "/items?ids=1,2,3,4", "", nil, http.StatusBadRequest},
+		{"batch at the limit", http.MethodPost, "/items/batch", jsonItems("batch", 2), nil, http.StatusCreated},
+		{"batch past the limit", http.MethodPost, "/items/batch", jsonItems("big-batch", 3), nil, http.StatusRequestEntityTooLarge},
+		{"upsert at the limit", http.MethodPost, "/items/bulk-upsert-by-name", jsonItems("upsert", 2), nil, http.StatusOK},
+		{"upsert past the limit", http.MethodPost, "/items/bulk-upsert-by-name", jsonItems("upsert", 3), nil, http.StatusRequestEntityTooLarge},
+		{"import past the limit", http.MethodPost, "/admin/import", dump, []string{"Authorization", "Bearer secret"}, http.StatusRequestEntityTooLarge},
+		{"csv at the limit", http.MethodPost, "/items/import/validate", "name,value\na,1\nb,2\n", []string{"Content-Type", "text/csv"}, http.StatusOK},
+		{"csv past the limit", http.MethodPost, "/items/import/validate", "name,value\na,1\nb,2\nc,3\n", []string{"Content-Type", "text/csv"}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mustDo(t, h, tt.status, tt.method, tt.path, tt.body, tt.headers...)
+		})
+	}
+}
+
+func TestHeaderLimitMiddleware(t *testing.T) {
+	h := headerLimitMiddleware(3, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"at the limit", http.Header{"A": {"1"}, "B": {"2"}, "C": {"3"}}, http.StatusOK},
+		{"past the limit", http.Header{"A": {"1"}, "B": {"2"}, "C": {"3"}, "D": {"4"}}, http.StatusRequestHeaderFieldsTooLarge},
+		{"repeated field", http.Header{"A": {"1", "2", "3", "4"}}, http.StatusRequestHeaderFieldsTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header = tt.header
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestElementLimitsConfig(t *testing.T) {
+	for _, env := range []string{"MAX_IDS", "MAX_BATCH_ITEMS", "CSV_VALIDATE_MAX_ROWS"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, "0")
+			if _, err := loadElementLimits(make(settingSet)); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("%s=0: got error %v", env, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// limitListener accepts at most max connections at a time, like
+// golang.org/x/net/netutil.LimitListener: past it, Accept waits for an open
+// connection to be closed, so that further clients are held in the kernel
+// backlog instead of being served. Idle keep-alive connections would hold
+// their slots forever, so keep-alives are switched off with setKeepAlives
+// while the limit is reached, which closes the idle ones, and back on once
+// half the slots are free.
+type limitListener struct {
+	net.Listener
+	sem           chan struct{}
+	setKeepAlives func(bool)
+
+	// full is set from the time the limit is reached until half of the
+	// slots are free again.
+	full atomic.Bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLimitListener(l net.Listener, max int, setKeepAlives func(bool)) *limitListener {
+	return &limitListener{
+		Listener:      l,
+		sem:           make(chan struct{}, max),
+		setKeepAlives: setKeepAlives,
+		done:          make(chan struct{}),
+	}
+}
+
+// acquire takes a slot, waiting for one if need be, and reports false if
+// the listener is closed first.
+func (l *limitListener) acquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if l.full.CompareAndSwap(false, true) {
+		warnf("connection limit of %d reached, holding new connections and closing idle ones", cap(l.sem))
+		l.setKeepAlives(false)
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *limitListener) release() {
+	<-l.sem
+	if len(l.sem) <= cap(l.sem)/2 && l.full.CompareAndSwap(true, false) {
+		infof("connections back to %d of %d, keep-alive enabled again", len(l.sem), cap(l.sem))
+		l.setKeepAlives(true)
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.acquire() {
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: l.release}, nil
+}
+
+// Close stops accepting, and releases an Accept waiting for a slot, as
+// http.Server.Shutdown expects. Open connections keep their slots until
+// they are closed in turn.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn gives its slot back once closed, however many times Close is
+// called.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Locker hands out named locks for writes that must be serialized across
+// every replica sharing a backend, such as the name uniqueness check. A
+// lock expires after its TTL so that a crashed holder cannot block the
+// others forever.
+type Locker interface {
+	AcquireLock(key string, ttl time.Duration) error
+	ReleaseLock(key string) error
+}
+
+// localLocker is the single-node Locker: the MemoryStore already
+// serializes its writes under its own mutex, so there is nothing to lock.
+// It does not protect replicas from each other; a deployment sharing a
+// backend between replicas needs a Locker backed by Redis, etcd or the
+// backend itself.
+type localLocker struct{}
+
+func (localLocker) AcquireLock(string, time.Duration) error { return nil }
+func (localLocker) ReleaseLock(string) error                { return nil }
+
+// nameLockTTL bounds how long a name lock is held by a writer that fails
+// to release it.
+const nameLockTTL = 10 * time.Second
+
+// LockingStore is a Store decorator taking a lock on the names written by
+// the calls that check name uniqueness or look items up by name. Copies
+// and transactions, whose names are only known inside the store, are not
+// locked.
+type LockingStore struct {
+	Store
+	locker Locker
+}
+
+func NewLockingStore(inner Store, locker Locker) *LockingStore {
+	return &LockingStore{Store: inner, locker: locker}
+}
+
+// lockNames acquires the locks of names, in a fixed order so that two
+// writers wanting the same names cannot deadlock, and returns the function
+// releasing them.
+func (l *LockingStore) lockNames(names ...string) (func(), error) {
+	keys := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		// Normalizing and folding case regardless of the store settings
+		// can only make two names share a lock, never split one name over
+		// two locks.
+		k := "name:" + strings.ToLower(normalizeName(n))
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	release := func(held []string) {
+		for i := len(held) - 1; i >= 0; i-- {
+			_ = l.locker.ReleaseLock(held[i])
+		}
+	}
+	for i, k := range keys {
+		if err := l.locker.AcquireLock(k, nameLockTTL); err != nil {
+			release(keys[:i])
+			return nil, fmt.Errorf("locking %s: %w", k, err)
+		}
+	}
+	return func() { release(keys) }, nil
+}
+
+func (l *LockingStore) AddItem(it Item) (Item, error) {
+	unlock, err := l.lockNames(it.Name)
+	if err != nil {
+		return Item{}, err
+	}
+	defer unlock()
+	return l.Store.AddItem(it)
+}
+
+func (l *LockingStore) AddItemIfNameAbsent(it Item) (Item, bool, error) {
+	unlock, err := l.lockNames(it.Name)
+	if err != nil {
+		return Item{}, false, err
+	}
+	defer unlock()
+	return l.Store.AddItemIfNameAbsent(it)
+}
+
+func (l *LockingStore) UpdateItem(id int, it Item) (Item, error) {
+	unlock, err := l.lockNames(it.Name)
+	if err != nil {
+		return Item{}, err
+	}
+	defer unlock()
+	return l.Store.UpdateItem(id, it)
+}
+
+func (l *LockingStore) UpdateItemIf(id int, it Item, precond func(current Item) error) (Item, error) {
+	unlock, err := l.lockNames(it.Name)
+	if err != nil {
+		return Item{}, err
+	}
+	defer unlock()
+	return l.Store.UpdateItemIf(id, it, precond)
+}
+
+func (l *LockingStore) UpsertByName(items []Item) ([]UpsertResult, error) {
+	names := make([]string, len(items))
+	for i, it := range items {
+		names[i] = it.Name
+	}
+	unlock, err := l.lockNames(names...)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return l.Store.UpsertByName(items)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// logLevel orders the severities of log messages. Messages below the
+// current level, see setLogLevel, are dropped.
+type logLevel int32
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	if l < levelDebug || l > levelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return logLevelNames[l]
+}
+
+// parseLogLevel parses one of debug, info, warn and error, in any case.
+func parseLogLevel(v string) (logLevel, error) {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(v, name) {
+			return logLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", v)
+}
+
+// currentLogLevel is the level in effect, changed at runtime through
+// POST /admin/config. It starts at info.
+var currentLogLevel atomic.Int32
+
+func init() {
+	currentLogLevel.Store(int32(levelInfo))
+}
+
+func setLogLevel(l logLevel) {
+	currentLogLevel.Store(int32(l))
+}
+
+// logf writes a message at level l to the standard logger, prefixed with
+// the level, unless l is below the current level.
+func logf(l logLevel, format string, args ...any) {
+	if int32(l) < currentLogLevel.Load() {
+		return
+	}
+	_ = log.Output(3, strings.ToUpper(l.String())+" "+fmt.Sprintf(format, args...))
+}
+
+func debugf(format string, args ...any) { logf(levelDebug, format, args...) }
+func infof(format string, args ...any)  { logf(levelInfo, format, args...) }
+func warnf(format string, args ...any)  { logf(levelWarn, format, args...) }
+func errorf(format string, args ...any) { logf(levelError, format, args...) }
+
+// auditf logs a change made by an admin, whatever the current level.
+func auditf(format string, args ...any) {
+	_ = log.Output(2, "AUDIT "+fmt.Sprintf(format, args...))
+}
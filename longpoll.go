@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// generationHeader carries the store generation a listing reflects, the
+// value a long-polling client sends back in ?since=.
+const generationHeader = "X-Store-Generation"
+
+// changeNotifier broadcasts store mutations: every waiter holds the same
+// channel, which notify closes and replaces.
+type changeNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{ch: make(chan struct{})}
+}
+
+// wait returns a channel closed by the next notify.
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+func (n *changeNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// longPoll serves the ?wait= and ?since= parameters of a listing: it holds
+// the request until the store generation passes since, and reports true
+// when the listing should then be served. On timeout, or when the server
+// shuts down, it answers 304 with the generation unchanged; a client gone
+// in the meantime gets no answer at all.
+func (s *Server) longPoll(w http.ResponseWriter, r *http.Request, q url.Values) bool {
+	wait, err := time.ParseDuration(q.Get("wait"))
+	if err != nil || wait <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid wait %q, expected a positive duration such as 30s", q.Get("wait")))
+		return false
+	}
+	if wait > s.cfg.LongPollMaxWait {
+		wait = s.cfg.LongPollMaxWait
+	}
+	if !q.Has("since") {
+		writeError(w, http.StatusBadRequest, "wait requires since, the "+generationHeader+" of the last listing")
+		return false
+	}
+	since, err := strconv.ParseUint(q.Get("since"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid since %q, expected a store generation", q.Get("since")))
+		return false
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	for {
+		// Take the channel before reading the generation, so that a write
+		// in between closes the channel rather than going unnoticed.
+		changed := s.reads.Changed()
+		gen := s.reads.Generation()
+		if gen > since {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-t.C:
+			w.Header().Set(generationHeader, strconv.FormatUint(gen, 10))
+			w.WriteHeader(http.StatusNotModified)
+			return false
+		case <-s.stopping:
+			w.Header().Set(generationHeader, strconv.FormatUint(gen, 10))
+			w.WriteHeader(http.StatusNotModified)
+			return false
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+// releaseWaiters ends the pending long polls, so that they do not hold up a
+// graceful shutdown. It is safe to call more than once.
+func (s *Server) releaseWaiters() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
@@ -1,10 +1,244 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-    fmt.Fprintf(os.Stdout, "Hello world")
-}
\ No newline at end of file
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	setLogLevel(cfg.LogLevel)
+
+	opts := []StoreOption{
+		WithUniqueNames(cfg.UniqueNames),
+		WithNameNormalization(cfg.NormalizeNames),
+		WithCaseSensitiveNames(cfg.CaseSensitiveNames),
+		WithItemLimits(cfg.ItemLimits),
+		WithIDSequence(cfg.IDStart, cfg.IDStep),
+		WithIndexes(cfg.IndexFields...),
+	}
+	if len(cfg.NameDenyList) > 0 || cfg.NameDenyListFile != "" {
+		deny, err := NewNameDenyList(cfg.NameDenyList, cfg.NameDenyListFile)
+		if err != nil {
+			return fmt.Errorf("loading name deny-list: %w", err)
+		}
+		infof("blocking names matching %d deny-list rules", deny.Len())
+		opts = append(opts, WithNameDenyList(deny))
+		if cfg.NameDenyListFile != "" {
+			go reloadOnHangup(deny)
+		}
+	}
+	// The replica copies are built like the store, but never saved.
+	replicaOpts := append([]StoreOption(nil), opts...)
+	var persister *FilePersister
+	if cfg.Persist.Path != "" {
+		persister = NewFilePersister(cfg.Persist)
+		opts = append(opts, WithPersister(persister))
+	}
+	var store Store
+	if cfg.Shards > 1 {
+		shards := make([]*MemoryStore, cfg.Shards)
+		for i := range shards {
+			if shards[i], err = NewMemoryStore(opts...); err != nil {
+				return fmt.Errorf("creating store: %w", err)
+			}
+		}
+		if store, err = NewShardedRouter(cfg.IDStart, cfg.IDStep, shards...); err != nil {
+			return fmt.Errorf("creating store: %w", err)
+		}
+		infof("spreading items over %d shards", cfg.Shards)
+	} else if store, err = NewMemoryStore(opts...); err != nil {
+		return fmt.Errorf("creating store: %w", err)
+	}
+	if persister != nil {
+		if err := persister.Open(); err != nil {
+			return fmt.Errorf("opening data file: %w", err)
+		}
+		// Deferred first so that it runs last, once no request and no
+		// other shutdown step can still change the store.
+		defer func() {
+			infof("shutdown: saving the store to %s", cfg.Persist.Path)
+			if err := persister.Close(); err != nil {
+				errorf("closing data file: %v", err)
+			}
+		}()
+	}
+	if cfg.ReplayFile != "" {
+		if persister != nil {
+			<-persister.Loaded()
+		}
+		n, err := Replay(store, cfg.ReplayFile)
+		if err != nil {
+			return fmt.Errorf("replaying %s: %w", cfg.ReplayFile, err)
+		}
+		infof("replayed %d operations from %s", n, cfg.ReplayFile)
+	}
+
+	if cfg.SeedFile != "" {
+		if persister != nil {
+			<-persister.Loaded()
+		}
+		if n := store.Len(); n > 0 && cfg.SeedOnlyIfEmpty {
+			infof("store already has %d items, not seeding from %s", n, cfg.SeedFile)
+		} else {
+			n, err := Seed(store, cfg.SeedFile)
+			if err != nil {
+				return fmt.Errorf("seeding from %s: %w", cfg.SeedFile, err)
+			}
+			infof("seeded %d items from %s", n, cfg.SeedFile)
+		}
+	}
+
+	// The single-node locker is a no-op; it keeps the write paths going
+	// through a Locker for when replicas share a backend.
+	var handlerStore Store = NewLockingStore(store, localLocker{})
+	if cfg.RecordFile != "" {
+		rec, err := NewRecordingStore(handlerStore, cfg.RecordFile)
+		if err != nil {
+			return fmt.Errorf("opening record file: %w", err)
+		}
+		defer rec.Close()
+		handlerStore = rec
+		infof("recording store mutations to %s", cfg.RecordFile)
+	}
+	// Every mutation is published on the bus; consumers subscribe to it.
+	bus := NewEventBus()
+	handlerStore = NewEventStore(handlerStore, bus)
+	var events *EventDispatcher
+	if len(cfg.Events.WebhookURLs) > 0 {
+		sinks := make([]EventSink, len(cfg.Events.WebhookURLs))
+		for i, u := range cfg.Events.WebhookURLs {
+			sinks[i] = newWebhookSink(u, cfg.Events.WebhookTimeout, cfg.idCodec())
+		}
+		events = NewEventDispatcher(cfg.Events, bus, sinks...)
+		// Deferred before the server is built, so it runs after shutdown
+		// and delivers the events of the last requests.
+		defer func() {
+			infof("shutdown: delivering %d queued events", events.Stats().QueueDepth)
+			events.Close()
+		}()
+		infof("delivering item events to %d webhooks", len(sinks))
+	}
+
+	var replica *ReadReplicaStore
+	if cfg.Replica.Enabled {
+		if replica, err = NewReadReplicaStore(store, cfg.Replica, replicaOpts...); err != nil {
+			return fmt.Errorf("creating read replica: %w", err)
+		}
+		defer replica.Close()
+		if cfg.Replica.Refresh == 0 {
+			infof("serving GET requests from a read replica refreshed after every write")
+		} else {
+			infof("serving GET requests from a read replica refreshed every %s", cfg.Replica.Refresh)
+		}
+	}
+
+	var active inFlight
+	app := newServer(cfg, handlerStore, persister, events)
+	if replica != nil {
+		app.reads = replica
+	}
+	shutdown := make(chan string, 1)
+	app.shutdown = shutdown
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           active.middleware(app.routes()),
+		ReadHeaderTimeout: 10 * time.Second,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	srv.RegisterOnShutdown(app.releaseWaiters)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	if cfg.MaxConnections > 0 {
+		ln = newLimitListener(ln, cfg.MaxConnections, srv.SetKeepAlivesEnabled)
+		infof("accepting at most %d connections", cfg.MaxConnections)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		infof("listening on %s", cfg.Addr)
+		errc <- srv.Serve(ln)
+	}()
+
+	var loadErr <-chan error
+	if persister != nil {
+		loadErr = persister.LoadErr()
+	}
+	select {
+	case err := <-errc:
+		return fmt.Errorf("server: %w", err)
+	case err := <-loadErr:
+		_ = srv.Close()
+		return fmt.Errorf("loading data file: %w", err)
+	case <-ctx.Done():
+	case <-shutdown:
+	}
+
+	// Only once the requests are drained do the deferred steps deliver the
+	// last events and save the store, so the final flush sees every write.
+	return drain(srv, &active, cfg.ShutdownTimeout)
+}
+
+// drain stops srv accepting connections, then waits for the requests in
+// flight, up to timeout, before closing the connections left and waiting
+// for their handlers to return.
+func drain(srv *http.Server, active *inFlight, timeout time.Duration) error {
+	infof("shutdown: stopped accepting requests, waiting up to %s for %d in flight", timeout, active.Count())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			warnf("shutdown timeout hit with %d requests still in flight, forcing close", active.Count())
+		}
+		err = srv.Close()
+		// Closing the connections does not wait for their handlers, which
+		// could still be writing to the store while it is saved.
+		if !active.Wait(drainGrace) {
+			warnf("shutdown: %d requests still running after %s, their changes may not be saved", active.Count(), drainGrace)
+			return err
+		}
+	}
+	infof("shutdown: all requests drained")
+	return err
+}
+
+// reloadOnHangup reloads the deny-list file on every SIGHUP, keeping the
+// current rules when the file cannot be read.
+func reloadOnHangup(deny *NameDenyList) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := deny.Reload(); err != nil {
+			warnf("reloading name deny-list: %v, keeping the current rules", err)
+			continue
+		}
+		infof("reloaded name deny-list: %d rules", deny.Len())
+	}
+}
+
+// drainGrace bounds how long a forced shutdown waits for the handlers of
+// the connections it closed to return.
+const drainGrace = 5 * time.Second
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDrainSavesInFlightWrites shuts a server down while a write is being
+// served, as run does on SIGTERM, and checks that the final flush of a
+// write-behind store has the write.
+func TestDrainSavesInFlightWrites(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		write   time.Duration
+	}{
+		{"within the timeout", 5 * time.Second, 50 * time.Millisecond},
+		{"past the timeout", 20 * time.Millisecond, 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := PersistConfig{Path: filepath.Join(t.TempDir(), "data.json"), WriteBehind: true, Interval: time.Hour, BatchSize: 1000}
+			persister := NewFilePersister(cfg)
+			store, err := NewMemoryStore(WithPersister(persister))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := persister.Open(); err != nil {
+				t.Fatal(err)
+			}
+
+			started := make(chan struct{})
+			var active inFlight
+			srv := &http.Server{Handler: active.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(tt.write)
+				if _, err := store.AddItem(Item{Name: "late"}); err != nil {
+					t.Errorf("adding the item: %v", err)
+				}
+			}))}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go srv.Serve(ln)
+			go func() {
+				resp, err := http.Post("http://"+ln.Addr().String()+"/items", "application/json", nil)
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+
+			if err := drain(srv, &active, tt.timeout); err != nil {
+				t.Fatalf("drain: %v", err)
+			}
+			if n := active.Count(); n != 0 {
+				t.Fatalf("%d requests still in flight after drain", n)
+			}
+			if err := persister.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded := NewFilePersister(PersistConfig{Path: cfg.Path})
+			saved, err := NewMemoryStore(WithPersister(reloaded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := reloaded.Open(); err != nil {
+				t.Fatal(err)
+			}
+			if saved.Len() != 1 {
+				t.Errorf("data file holds %d items, want the one written while shutting down", saved.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Media types of the two text exposition formats /metrics can answer in.
+const (
+	openMetricsType = "application/openmetrics-text"
+	promTextType    = "text/plain"
+)
+
+// httpMetrics counts the responses served, by status code.
+type httpMetrics struct {
+	byStatus [600]atomic.Int64
+}
+
+func (m *httpMetrics) observe(status int) {
+	if status < 100 || status >= len(m.byStatus) {
+		return
+	}
+	m.byStatus[status].Add(1)
+}
+
+// metricsMiddleware counts every response of next by status code.
+func metricsMiddleware(m *httpMetrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.observe(rec.status)
+		debugf("[%s] %s %s from %s: %d in %s", requestID(r.Context()), r.Method, r.URL.RequestURI(), r.RemoteAddr, rec.status, time.Since(start))
+	})
+}
+
+// statusRecorder is a ResponseWriter remembering the status sent.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// metricsHandler serves the counters in the OpenMetrics text format, or
+// in the older Prometheus text format to scrapers that do not ask for
+// OpenMetrics. The two only differ in how counters are declared and in
+// the final "# EOF".
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	ct, ok := negotiate(r, promTextType, openMetricsType)
+	if !ok {
+		checkAccept(w, r, promTextType, openMetricsType)
+		return
+	}
+	if ct == openMetricsType {
+		w.Header().Set("Content-Type", openMetricsType+"; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", promTextType+"; version=0.0.4; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	mw := &metricsWriter{w: bufio.NewWriter(w), openMetrics: ct == openMetricsType}
+
+	mw.family("pacdemo_http_requests", "counter", "HTTP responses served, by status code.")
+	for code := range s.metrics.byStatus {
+		if n := s.metrics.byStatus[code].Load(); n > 0 {
+			mw.sample("pacdemo_http_requests_total", `code="`+strconv.Itoa(code)+`"`, n)
+		}
+	}
+
+	mw.family("pacdemo_items", "gauge", "Items in the store.")
+	mw.sample("pacdemo_items", "", int64(s.store.Len()))
+
+	st := s.store.Stats()
+	mw.family("pacdemo_store_operations", "counter", "Store operations, by operation.")
+	for _, op := range []struct {
+		name string
+		n    int64
+	}{
+		{"add", st.Adds}, {"update", st.Updates}, {"delete", st.Deletes},
+		{"get", st.Gets}, {"not_found", st.NotFound},
+	} {
+		mw.sample("pacdemo_store_operations_total", `op="`+op.name+`"`, op.n)
+	}
+
+	if s.events != nil {
+		es := s.events.Stats()
+		mw.family("pacdemo_event_queue_depth", "gauge", "Events waiting for delivery.")
+		mw.sample("pacdemo_event_queue_depth", "", int64(es.QueueDepth))
+		mw.family("pacdemo_events", "counter", "Events, by outcome.")
+		for _, o := range []struct {
+			name string
+			n    int64
+		}{
+			{"published", es.Published}, {"dropped", es.Dropped}, {"delivered", es.Delivered},
+			{"failed", es.Failed}, {"retried", es.Retries},
+		} {
+			mw.sample("pacdemo_events_total", `outcome="`+o.name+`"`, o.n)
+		}
+	}
+
+	if mw.openMetrics {
+		_, _ = mw.w.WriteString("# EOF\n")
+	}
+	_ = mw.w.Flush()
+}
+
+// metricsWriter writes metric families in either text format.
+type metricsWriter struct {
+	w           *bufio.Writer
+	openMetrics bool
+}
+
+// family declares a metric family. In the Prometheus format a counter
+// family is named after its _total samples.
+func (m *metricsWriter) family(name, typ, help string) {
+	if typ == "counter" && !m.openMetrics {
+		name += "_total"
+	}
+	_, _ = fmt.Fprintf(m.w, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+}
+
+func (m *metricsWriter) sample(name, labels string, v int64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	_, _ = fmt.Fprintf(m.w, "%s %d\n", name, v)
+}
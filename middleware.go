@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inFlight counts the requests currently being served.
+type inFlight struct {
+	n  atomic.Int64
+	wg sync.WaitGroup
+}
+
+func (f *inFlight) Count() int64 { return f.n.Load() }
+
+// Wait waits for the requests being served to return, for at most
+// timeout, and reports whether they all did.
+func (f *inFlight) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+func (f *inFlight) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.wg.Add(1)
+		f.n.Add(1)
+		defer func() {
+			f.n.Add(-1)
+			f.wg.Done()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
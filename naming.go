@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// JSON field naming conventions. Field names are snake_case in the code;
+// camelCase is applied to responses on the way out.
+const (
+	namingSnake = "snake_case"
+	namingCamel = "camelCase"
+)
+
+// clientKeyedFields are the fields whose values are objects keyed by
+// clients rather than by the API, and whose keys are never renamed.
+var clientKeyedFields = map[string]bool{"metadata": true, "groups": true, "settings": true}
+
+// camelCase turns a snake_case name into camelCase: created_at becomes
+// createdAt.
+func camelCase(name string) string {
+	if !strings.Contains(name, "_") {
+		return name
+	}
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		if c == '_' {
+			upper = b.Len() > 0
+			continue
+		}
+		if upper {
+			c = unicode.ToUpper(c)
+			upper = false
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// snakeCase turns a camelCase name into snake_case: createdAt becomes
+// created_at. Names without a lower-case letter followed by an upper-case
+// one are only lower-cased, so snake_case names and the case variants
+// encoding/json matches anyway are kept.
+func snakeCase(name string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, c := range name {
+		if unicode.IsUpper(c) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+		prev = c
+	}
+	return b.String()
+}
+
+// renameKeys rewrites the object keys of the JSON document b with rename,
+// keeping their order and leaving the keys of the clientKeyedFields objects
+// alone. Only a single, well-formed value is rewritten; anything else is an
+// error.
+func renameKeys(b []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out bytes.Buffer
+	out.Grow(len(b))
+	if err := renameValue(dec, &out, rename, false); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after the JSON value")
+	}
+	if bytes.HasSuffix(b, []byte{'\n'}) {
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// renameValue copies the next value of dec to out, renaming the keys of its
+// objects. keep leaves the keys of the value itself, if an object, alone,
+// though not those of the objects nested in it.
+func renameValue(dec *json.Decoder, out *bytes.Buffer, rename func(string) string, keep bool) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		out.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			kt, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := kt.(string)
+			name := key
+			if !keep {
+				name = rename(key)
+			}
+			kb, _ := json.Marshal(name)
+			out.Write(kb)
+			out.WriteByte(':')
+			if err := renameValue(dec, out, rename, !keep && clientKeyedFields[key]); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		out.WriteByte('}')
+	case json.Delim('['):
+		out.WriteByte('[')
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := renameValue(dec, out, rename, false); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		out.WriteByte(']')
+	default:
+		vb, err := json.Marshal(tok)
+		if err != nil {
+			return err
+		}
+		out.Write(vb)
+	}
+	return nil
+}
+
+// responseNaming returns the naming convention of the responses to r: the
+// one asked for with Accept: application/json; profile="camelCase" or
+// profile="snake_case", or else def.
+func responseNaming(r *http.Request, def string) string {
+	switch {
+	case acceptsProfile(r, namingCamel):
+		return namingCamel
+	case acceptsProfile(r, namingSnake):
+		return namingSnake
+	}
+	return def
+}
+
+// namingMiddleware renames the fields of JSON responses to camelCase for
+// the requests that get that convention. snake_case responses, downloads
+// and responses of other media types are passed through untouched.
+func namingMiddleware(def string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if responseNaming(r, def) != namingCamel {
+			next.ServeHTTP(w, r)
+			return
+		}
+		nw := &namingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(nw, r)
+		nw.finish()
+	})
+}
+
+// namingWriter holds back JSON responses until the handler is done, so
+// that their keys can be renamed as a whole.
+type namingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffering   bool
+	buf         bytes.Buffer
+}
+
+func (n *namingWriter) WriteHeader(status int) {
+	if n.wroteHeader {
+		return
+	}
+	n.wroteHeader, n.status = true, status
+	if renamable(n.Header(), status) {
+		n.buffering = true
+		return
+	}
+	n.ResponseWriter.WriteHeader(status)
+}
+
+// renamable reports whether the response with header h and status is
+// renamed: a JSON document, served whole and inline. Attachments, such as
+// exports, are files written in one convention whatever the client's, and
+// must not be held back, being streamed; a range of one would not match
+// the file anyway.
+func renamable(h http.Header, status int) bool {
+	switch status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	if mt, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mt != "application/json" {
+		return false
+	}
+	if d, _, _ := mime.ParseMediaType(h.Get("Content-Disposition")); d == "attachment" {
+		return false
+	}
+	return h.Get("Content-Range") == ""
+}
+
+func (n *namingWriter) Write(p []byte) (int, error) {
+	if !n.wroteHeader {
+		n.WriteHeader(http.StatusOK)
+	}
+	if n.buffering {
+		return n.buf.Write(p)
+	}
+	return n.ResponseWriter.Write(p)
+}
+
+// finish writes the held back response, renamed. A body that fails to
+// parse is written as is.
+func (n *namingWriter) finish() {
+	if !n.buffering {
+		return
+	}
+	body := n.buf.Bytes()
+	if renamed, err := renameKeys(body, camelCase); err == nil {
+		body = renamed
+	}
+	n.Header().Del("Content-Length")
+	n.ResponseWriter.WriteHeader(n.status)
+	_, _ = n.ResponseWriter.Write(body)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNamingMiddleware(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"JSON_NAMING": "camelCase", "ADMIN_TOKEN": "secret"})
+	mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3}`)
+
+	tests := []struct {
+		name    string
+		path    string
+		headers []string
+		status  int
+		want    string
+	}{
+		{"item", "/items/1", nil, http.StatusOK, `"createdAt"`},
+		{"listing", "/items", nil, http.StatusOK, `"createdAt"`},
+		{"snake_case profile", "/items/1", []string{"Accept", `application/json; profile="snake_case"`}, http.StatusOK, `"created_at"`},
+		{"json export", "/items/export.json", nil, http.StatusOK, `"created_at"`},
+		{"json export range", "/items/export.json", []string{"Range", "bytes=0-99"}, http.StatusPartialContent, `"created_at"`},
+		{"admin export", "/admin/export", []string{"Authorization", "Bearer secret"}, http.StatusOK, `"created_at"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := mustDo(t, h, tt.status, http.MethodGet, tt.path, "", tt.headers...)
+			if body := rec.Body.String(); !strings.Contains(body, tt.want) {
+				t.Errorf("got %s, want it to contain %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"created_at":1}`, `{"createdAt":1}`},
+		{`[{"updated_at":"x","tags":["a_b"]}]`, `[{"updatedAt":"x","tags":["a_b"]}]`},
+		{`{"metadata":{"some_key":{"nested_key":1}}}`, `{"metadata":{"some_key":{"nestedKey":1}}}`},
+		{`{"groups":{"a_b":{"item_count":2}}}`, `{"groups":{"a_b":{"itemCount":2}}}`},
+		{`{"value":12345678901234567890}` + "\n", `{"value":12345678901234567890}` + "\n"},
+	}
+	for _, tt := range tests {
+		got, err := renameKeys([]byte(tt.in), camelCase)
+		if err != nil {
+			t.Errorf("renameKeys(%s): %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("renameKeys(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if _, err := renameKeys([]byte(`{} {}`), camelCase); err == nil {
+		t.Error("renameKeys accepted two values")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiate picks the media type among offered that best satisfies the
+// Accept header of r, honouring q values and preferring the earlier offer
+// on ties. A missing Accept header accepts anything. It reports false when
+// none of the offers is acceptable.
+func negotiate(r *http.Request, offered ...string) (string, bool) {
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return offered[0], true
+	}
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, o := range offered {
+		if q := acceptQuality(accept, o); q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// acceptQuality returns the q value the Accept headers give to mediaType,
+// taken from the most specific matching range; 0 means not acceptable.
+func acceptQuality(accept []string, mediaType string) float64 {
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, h := range accept {
+		for _, rng := range strings.Split(h, ",") {
+			rng = strings.TrimSpace(rng)
+			if rng == "" {
+				continue
+			}
+			mt, params, err := mime.ParseMediaType(rng)
+			if err != nil {
+				continue
+			}
+			rt, rs, _ := strings.Cut(mt, "/")
+			var spec int
+			switch {
+			case rt == typ && rs == sub:
+				spec = 2
+			case rt == typ && rs == "*":
+				spec = 1
+			case rt == "*" && rs == "*":
+				spec = 0
+			default:
+				continue
+			}
+			if spec <= specificity {
+				continue
+			}
+			rq := 1.0
+			if v, ok := params["q"]; ok {
+				if rq, err = strconv.ParseFloat(v, 64); err != nil {
+					rq = 0
+				}
+			}
+			q, specificity = rq, spec
+		}
+	}
+	return q
+}
+
+// envelopeProfile is the Accept profile asking for enveloped responses:
+// Accept: application/json; profile="envelope".
+const envelopeProfile = "envelope"
+
+// acceptsProfile reports whether an Accept range of r for JSON carries the
+// given profile parameter. The parameter may list several profiles
+// separated by spaces, such as profile="envelope camelCase".
+func acceptsProfile(r *http.Request, profile string) bool {
+	for _, h := range r.Header.Values("Accept") {
+		for _, rng := range strings.Split(h, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(rng))
+			if err != nil || mt != "application/json" {
+				continue
+			}
+			for _, p := range strings.Fields(params["profile"]) {
+				if p == profile {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkAccept answers 406, listing the offered media types, when the
+// client accepts none of them, and reports whether the handler should
+// carry on.
+func checkAccept(w http.ResponseWriter, r *http.Request, offered ...string) bool {
+	if _, ok := negotiate(r, offered...); ok {
+		return true
+	}
+	writeJSON(w, http.StatusNotAcceptable, map[string]any{
+		"error":     fmt.Sprintf("none of the accepted media types is supported, expected %s", strings.Join(offered, " or ")),
+		"supported": offered,
+	})
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{"application/json", "text/html"}
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", "application/json", true},
+		{"*/*", "application/json", true},
+		{"application/json", "application/json", true},
+		{"text/html", "text/html", true},
+		{"text/*", "text/html", true},
+		{"text/html;q=0.5, application/json;q=0.9", "application/json", true},
+		{"text/html, application/json", "application/json", true},
+		{"application/json;q=0, */*", "text/html", true},
+		{"application/yaml", "", false},
+		{"application/xml, text/xml", "", false},
+		{"*/*;q=0", "", false},
+		{"not a media type", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/items", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		got, ok := negotiate(r, offered...)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("negotiate(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCheckAccept(t *testing.T) {
+	_, h := newTestServer(t, nil)
+	tests := []struct {
+		accept string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"*/*", http.StatusOK},
+		{"application/json", http.StatusOK},
+		{"text/html", http.StatusOK},
+		{"application/xml", http.StatusNotAcceptable},
+		{"application/yaml", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.accept != "" {
+			headers = []string{"Accept", tt.accept}
+		}
+		rec := mustDo(t, h, tt.status, http.MethodGet, "/items", "", headers...)
+		if tt.status != http.StatusNotAcceptable {
+			continue
+		}
+		var body struct {
+			Supported []string `json:"supported"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body.Supported) == 0 {
+			t.Errorf("Accept %q: 406 body %s does not list the supported types", tt.accept, rec.Body.String())
+		}
+	}
+}
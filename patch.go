@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// mergePatchType is the media type of an RFC 7386 JSON merge patch.
+const mergePatchType = "application/merge-patch+json"
+
+// readOnlyFields are the item fields managed by the store, which a patch
+// must not set.
+var readOnlyFields = []string{"id", "created_at", "updated_at"}
+
+// maskFields are the item fields an update mask can name: those a patch
+// may set.
+var maskFields = []string{"name", "category", "value", "tags", "metadata"}
+
+// parseUpdateMask parses a comma-separated ?mask= of item fields.
+func parseUpdateMask(v string) ([]string, error) {
+	var mask []string
+	for _, f := range strings.Split(v, ",") {
+		f = snakeCase(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		known := false
+		for _, m := range maskFields {
+			known = known || f == m
+		}
+		if !known {
+			for _, ro := range readOnlyFields {
+				if f == ro {
+					return nil, fmt.Errorf("%s is read-only and cannot be in the update mask", f)
+				}
+			}
+			return nil, fmt.Errorf("invalid update mask field %q, expected one of %s", f, strings.Join(maskFields, ", "))
+		}
+		mask = append(mask, f)
+	}
+	if len(mask) == 0 {
+		return nil, fmt.Errorf("update mask names no field")
+	}
+	return mask, nil
+}
+
+// maskPatch restricts the merge patch doc to the fields of mask. A masked
+// field missing from doc is cleared: the mask says exactly which fields
+// change, so the body does not need null to reset one.
+func maskPatch(doc map[string]any, mask []string) map[string]any {
+	patch := make(map[string]any, len(mask))
+	for _, f := range mask {
+		patch[f] = doc[f]
+	}
+	return patch
+}
+
+// mergePatch applies an RFC 7386 merge patch to target: members of patch
+// overwrite those of target, objects are merged recursively and a null
+// member removes the target member.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// applyItemPatch returns it with the merge patch applied. Removed fields
+// fall back to their zero value, and the patched document must still be
+// a valid item.
+func applyItemPatch(it Item, patch map[string]any) (Item, error) {
+	for _, f := range readOnlyFields {
+		if _, ok := patch[f]; ok {
+			return Item{}, fmt.Errorf("%s is read-only and cannot be patched", f)
+		}
+	}
+	b, err := json.Marshal(it)
+	if err != nil {
+		return Item{}, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return Item{}, err
+	}
+	if b, err = json.Marshal(mergePatch(doc, patch)); err != nil {
+		return Item{}, err
+	}
+	var patched Item
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		return Item{}, describeDecodeError(err)
+	}
+	return patched, nil
+}
+
+// mergePatchAttempts bounds how often a patch is re-applied when the item
+// changes between reading it and writing the result.
+const mergePatchAttempts = 3
+
+// patchItemHandler serves PATCH /items/{id} with a JSON merge patch. The
+// patch is applied to the current item and the result written only if
+// the item did not change meanwhile, so concurrent patches of different
+// fields both take effect. With If-Match the patch is also refused with
+// 412 if the item no longer has that ETag. ?mask= restricts the patch to
+// the listed fields, see maskPatch.
+func (s *Server) patchItemHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if err := checkContentType(r, mergePatchType); err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	var doc any
+	if err := decodeJSON(w, r, s.cfg.MaxBodyBytes, s.cfg.JSONLimits, &doc); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid merge patch: %v", err))
+		return
+	}
+	// A patch that is not an object would replace the whole item.
+	patch, ok := doc.(map[string]any)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid merge patch: expected a JSON object")
+		return
+	}
+	if q := r.URL.Query(); q.Has("mask") {
+		mask, err := parseUpdateMask(q.Get("mask"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		patch = maskPatch(patch, mask)
+	}
+	updated, ok := s.patchItem(w, r, id, patch)
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", itemETag(updated))
+	s.writeItemResult(w, r, http.StatusOK, updated)
+}
+
+// patchItem applies patch to item id, retrying when the item changes
+// between reading it and writing the result, and honouring If-Match. On
+// failure it answers the error itself and reports false.
+func (s *Server) patchItem(w http.ResponseWriter, r *http.Request, id int, patch map[string]any) (Item, bool) {
+	ifMatchPrecond := ifMatch(r)
+
+	for attempt := 1; ; attempt++ {
+		current, err := s.store.GetItem(id)
+		if err != nil {
+			s.writeStoreError(w, err)
+			return Item{}, false
+		}
+		if ifMatchPrecond != nil {
+			if err := ifMatchPrecond(current); err != nil {
+				s.writeStoreError(w, err)
+				return Item{}, false
+			}
+		}
+		patched, err := applyItemPatch(current, patch)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid merge patch: %v", err))
+			return Item{}, false
+		}
+		base := itemETag(current)
+		updated, err := s.store.UpdateItemIf(id, patched, func(now Item) error {
+			if itemETag(now) != base {
+				return fmt.Errorf("item %d changed while being patched: %w", id, ErrConflict)
+			}
+			return nil
+		})
+		if errors.Is(err, ErrConflict) && attempt < mergePatchAttempts {
+			continue
+		}
+		if err != nil {
+			s.writeStoreError(w, err)
+			return Item{}, false
+		}
+		return updated, true
+	}
+}
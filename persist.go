@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PersistConfig controls how the store is saved to disk.
+type PersistConfig struct {
+	// Path of the data file. Persistence is disabled when it is empty.
+	Path string
+	// WriteBehind batches mutations instead of saving on every write.
+	WriteBehind bool
+	// Interval is how often write-behind mode flushes pending changes.
+	Interval time.Duration
+	// BatchSize makes write-behind mode flush early once this many
+	// changes are pending.
+	BatchSize int
+	// AsyncLoad loads the data file in the background instead of delaying
+	// startup until it is read.
+	AsyncLoad bool
+	// Degrade keeps write-through mode accepting writes when the data file
+	// cannot be saved, retrying every RetryInterval, instead of failing
+	// them.
+	Degrade       bool
+	RetryInterval time.Duration
+}
+
+// snapshot is the on-disk form of the store.
+type snapshot struct {
+	NextID int    `json:"next_id"`
+	Items  []Item `json:"items"`
+}
+
+// FilePersister saves a MemoryStore to a JSON file, replaced atomically on
+// every save.
+//
+// In write-through mode (the default) every mutation is written before the
+// request returns, under the store's write lock. That is durable but slow
+// under load. In write-behind mode mutations only mark the store dirty and
+// a background loop flushes every Interval, or as soon as BatchSize changes
+// are pending. A final flush runs on Close. The tradeoff is durability: a
+// crash loses the changes made since the last flush.
+//
+// When a save fails, write-through mode fails the write, unless Degrade is
+// set: then the change is kept in memory, the persister reports itself
+// degraded and a background loop retries the save until it succeeds.
+// Write-behind mode always works that way, its loop retrying at every
+// interval.
+type FilePersister struct {
+	cfg   PersistConfig
+	store *MemoryStore
+
+	// mu guards dirty, the number of mutations not yet on disk. It is
+	// separate from the store lock so marking a change stays cheap.
+	mu    sync.Mutex
+	dirty int
+
+	// fileMu serializes writes of the data file. When both are needed it
+	// is taken after the store lock.
+	fileMu sync.Mutex
+
+	// degradedMu guards the degraded state; write-through mutations hold
+	// it while deciding to skip the save, so that the retry loop cannot
+	// recover in between.
+	degradedMu    sync.Mutex
+	degradedErr   error
+	degradedSince time.Time
+	retries       sync.WaitGroup
+
+	// loaded is closed once the data file is in the store; loadedItems
+	// and totalItems report progress until then.
+	loaded      chan struct{}
+	loadErr     chan error
+	loadedItems atomic.Int64
+	totalItems  atomic.Int64
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// restoreChunk is how many items restore inserts per write lock, so that
+// an asynchronous load does not starve readers of the store.
+const restoreChunk = 1000
+
+func NewFilePersister(cfg PersistConfig) *FilePersister {
+	return &FilePersister{
+		cfg:     cfg,
+		loaded:  make(chan struct{}),
+		loadErr: make(chan error, 1),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// WithPersister saves the store through p. p.Open must then be called with
+// the store before it is used.
+func WithPersister(p *FilePersister) StoreOption {
+	return func(s *MemoryStore) error {
+		s.persister = p
+		p.store = s
+		return nil
+	}
+}
+
+// Open loads the data file into the store, if the file exists, and starts
+// the write-behind loop when enabled. With AsyncLoad it returns at once and
+// the load runs in the background: Loaded is closed when it completes and
+// LoadErr reports a failure.
+func (p *FilePersister) Open() error {
+	if !p.cfg.AsyncLoad {
+		return p.load()
+	}
+	go func() {
+		if err := p.load(); err != nil {
+			p.loadErr <- err
+		}
+	}()
+	return nil
+}
+
+func (p *FilePersister) load() error {
+	b, err := os.ReadFile(p.cfg.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("reading %s: %w", p.cfg.Path, err)
+	default:
+		var snap snapshot
+		if err := json.Unmarshal(b, &snap); err != nil {
+			return fmt.Errorf("decoding %s: %w", p.cfg.Path, err)
+		}
+		p.totalItems.Store(int64(len(snap.Items)))
+		p.store.restore(snap, func(n int) {
+			p.loadedItems.Store(int64(n))
+			if p.cfg.AsyncLoad && n%(100*restoreChunk) == 0 {
+				debugf("loading %s: %d/%d items", p.cfg.Path, n, len(snap.Items))
+			}
+		})
+		infof("loaded %d items from %s", len(snap.Items), p.cfg.Path)
+	}
+
+	if p.cfg.WriteBehind {
+		go p.loop()
+	} else {
+		close(p.done)
+	}
+	close(p.loaded)
+	return nil
+}
+
+// Loaded is closed once the data file has been loaded into the store.
+func (p *FilePersister) Loaded() <-chan struct{} { return p.loaded }
+
+// LoadErr receives the error of a failed asynchronous load.
+func (p *FilePersister) LoadErr() <-chan error { return p.loadErr }
+
+// LoadProgress reports whether the data file is still being loaded, and
+// how many of its items are in the store so far.
+func (p *FilePersister) LoadProgress() (loading bool, loaded, total int64) {
+	select {
+	case <-p.loaded:
+	default:
+		loading = true
+	}
+	return loading, p.loadedItems.Load(), p.totalItems.Load()
+}
+
+// mutated is called by the store, under its write lock, after each change.
+func (p *FilePersister) mutated(s *MemoryStore) error {
+	if !p.cfg.WriteBehind {
+		return p.writeThrough(s)
+	}
+
+	p.mu.Lock()
+	p.dirty++
+	full := p.dirty >= p.cfg.BatchSize
+	p.mu.Unlock()
+	if full {
+		select {
+		case p.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// writeThrough saves s right away. Once degraded it only counts the change,
+// which the retry loop saves along with the others.
+func (p *FilePersister) writeThrough(s *MemoryStore) error {
+	p.degradedMu.Lock()
+	defer p.degradedMu.Unlock()
+	if p.degradedErr != nil {
+		p.markDirty()
+		return nil
+	}
+	p.fileMu.Lock()
+	err := p.writeFile(s.snapshotLocked())
+	p.fileMu.Unlock()
+	if err == nil || !p.cfg.Degrade {
+		return err
+	}
+	errorf("persistence degraded, keeping writes in memory and retrying every %s: %v", p.cfg.RetryInterval, err)
+	p.degradedErr, p.degradedSince = err, time.Now().UTC()
+	p.markDirty()
+	p.retries.Add(1)
+	go p.retryLoop()
+	return nil
+}
+
+func (p *FilePersister) markDirty() {
+	p.mu.Lock()
+	p.dirty++
+	p.mu.Unlock()
+}
+
+// retryLoop flushes the store every RetryInterval until a flush succeeds
+// with nothing left pending, which ends the degraded state.
+func (p *FilePersister) retryLoop() {
+	defer p.retries.Done()
+	t := time.NewTicker(p.cfg.RetryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+		}
+		n, err := p.Flush()
+		p.degradedMu.Lock()
+		if err != nil {
+			p.degradedErr = err
+			p.degradedMu.Unlock()
+			warnf("persistence still degraded: %v", err)
+			continue
+		}
+		if p.pending() == 0 {
+			p.degradedErr = nil
+			p.degradedMu.Unlock()
+			infof("persistence recovered, flushed %d items to %s", n, p.cfg.Path)
+			return
+		}
+		p.degradedMu.Unlock()
+	}
+}
+
+// Degraded reports whether saves are failing, since when, and the last
+// error.
+func (p *FilePersister) Degraded() (degraded bool, since time.Time, err error) {
+	p.degradedMu.Lock()
+	defer p.degradedMu.Unlock()
+	return p.degradedErr != nil, p.degradedSince, p.degradedErr
+}
+
+// Pending returns the number of changes not yet saved.
+func (p *FilePersister) Pending() int { return p.pending() }
+
+func (p *FilePersister) loop() {
+	defer close(p.done)
+	t := time.NewTicker(p.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+		case <-p.kick:
+		}
+		if p.pending() == 0 {
+			continue
+		}
+		_, err := p.Flush()
+		p.degradedMu.Lock()
+		switch {
+		case err != nil && p.degradedErr == nil:
+			p.degradedSince = time.Now().UTC()
+			fallthrough
+		case err != nil:
+			p.degradedErr = err
+		case p.degradedErr != nil:
+			p.degradedErr = nil
+			infof("write-behind flush recovered")
+		}
+		p.degradedMu.Unlock()
+		if err != nil {
+			errorf("write-behind flush: %v", err)
+		}
+	}
+}
+
+func (p *FilePersister) pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dirty
+}
+
+// Flush writes the current store contents to disk and returns the number
+// of items written.
+func (p *FilePersister) Flush() (int, error) {
+	select {
+	case <-p.loaded:
+	default:
+		return 0, fmt.Errorf("%s is still loading: %w", p.cfg.Path, ErrTransient)
+	}
+	// Take the snapshot and claim the file under the store's read lock so
+	// that no write-through save can slip between them, then release the
+	// store before the slow disk write.
+	p.store.mu.RLock()
+	snap := p.store.snapshotLocked()
+	p.mu.Lock()
+	flushed := p.dirty
+	p.dirty = 0
+	p.mu.Unlock()
+	p.fileMu.Lock()
+	p.store.mu.RUnlock()
+	defer p.fileMu.Unlock()
+
+	if err := p.writeFile(snap); err != nil {
+		p.mu.Lock()
+		p.dirty += flushed
+		p.mu.Unlock()
+		return 0, err
+	}
+	return len(snap.Items), nil
+}
+
+// Close stops the write-behind loop and flushes what is still pending.
+// Nothing is written if the data file was not fully loaded, as that would
+// overwrite it with partial contents.
+func (p *FilePersister) Close() error {
+	select {
+	case <-p.loaded:
+	default:
+		return nil
+	}
+	close(p.stop)
+	<-p.done
+	p.retries.Wait()
+	// A healthy write-through store is already saved.
+	if !p.cfg.WriteBehind && p.pending() == 0 {
+		return nil
+	}
+	n, err := p.Flush()
+	if err != nil {
+		return fmt.Errorf("final flush: %w", err)
+	}
+	infof("flushed %d items to %s", n, p.cfg.Path)
+	return nil
+}
+
+// writeFile replaces the data file with snap. The caller holds fileMu.
+func (p *FilePersister) writeFile(snap snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(p.cfg.Path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p.cfg.Path)
+}
+
+// snapshotLocked copies the store contents. The caller holds s.mu.
+func (s *MemoryStore) snapshotLocked() snapshot {
+	snap := snapshot{NextID: s.nextID, Items: make([]Item, 0, len(s.items))}
+	for _, it := range s.items {
+		snap.Items = append(snap.Items, it)
+	}
+	sortItemsByID(snap.Items)
+	return snap
+}
+
+// restore loads snap into an empty store, without notifying the persister.
+// Items are inserted in chunks, each under its own write lock, and progress
+// is called with the number inserted after each chunk.
+func (s *MemoryStore) restore(snap snapshot, progress func(n int)) {
+	for start := 0; start < len(snap.Items); start += restoreChunk {
+		end := start + restoreChunk
+		if end > len(snap.Items) {
+			end = len(snap.Items)
+		}
+		s.mu.Lock()
+		for _, it := range snap.Items[start:end] {
+			s.putLocked(it)
+			if it.ID >= snap.NextID {
+				snap.NextID = it.ID + s.idStep
+			}
+		}
+		s.generation.Add(1)
+		s.changes.notify()
+		s.mu.Unlock()
+		progress(end)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if snap.NextID > s.nextID {
+		s.nextID = snap.NextID
+	}
+}
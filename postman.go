@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+var exampleItem = map[string]any{
+	"name":     "Widget",
+	"category": "tools",
+	"value":    42,
+	"tags":     []string{"new"},
+}
+
+// postmanExamples are the request bodies of the endpoints that take one,
+// keyed by method and path as listed in endpoints.
+var postmanExamples = map[string]struct {
+	contentType string
+	body        any
+}{
+	"POST /items":                     {"application/json", exampleItem},
+	"PUT /items/{id}":                 {"application/json", exampleItem},
+	"PATCH /items/{id}":               {mergePatchType, map[string]any{"value": 43}},
+	"PUT /items/{id}/value":           {"application/json", map[string]any{"value": 43}},
+	"POST /items/batch":               {"application/json", []any{exampleItem}},
+	"POST /items/validate":            {"application/json", exampleItem},
+	"POST /items/bulk-upsert-by-name": {"application/json", []any{exampleItem}},
+	"POST /admin/config":              {"application/json", map[string]any{"settings": map[string]string{"CACHE_MAX_AGE": "60"}}},
+}
+
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method      string          `json:"method"`
+	Description string          `json:"description"`
+	Header      []postmanHeader `json:"header"`
+	URL         postmanURL      `json:"url"`
+	Body        *postmanBody    `json:"body,omitempty"`
+}
+
+type postmanHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanURL struct {
+	Raw      string            `json:"raw"`
+	Host     []string          `json:"host"`
+	Path     []string          `json:"path"`
+	Variable []postmanVariable `json:"variable,omitempty"`
+}
+
+type postmanBody struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// buildPostmanCollection derives a Postman collection from the endpoint
+// index eps. Path parameters become Postman :variables, a path offering
+// alternatives like export.{csv,json} uses the first one, and endpoints
+// marked admin send the admin token. base is the initial baseUrl.
+func buildPostmanCollection(base string, eps []endpoint) postmanCollection {
+	c := postmanCollection{
+		Info: postmanInfo{Name: "pac-demo", Schema: postmanSchema},
+		Variable: []postmanVariable{
+			{Key: "baseUrl", Value: base},
+			{Key: "adminToken", Value: ""},
+		},
+	}
+	for _, e := range eps {
+		var (
+			segments []string
+			vars     []postmanVariable
+		)
+		for _, seg := range strings.Split(strings.Trim(e.Path, "/"), "/") {
+			if open := strings.Index(seg, "{"); open >= 0 && strings.HasSuffix(seg, "}") {
+				inner := seg[open+1 : len(seg)-1]
+				if alts := strings.Split(inner, ","); len(alts) > 1 {
+					seg = seg[:open] + alts[0]
+				} else {
+					seg = seg[:open] + ":" + inner
+					vars = append(vars, postmanVariable{Key: inner, Value: "1"})
+				}
+			}
+			if seg != "" {
+				segments = append(segments, seg)
+			}
+		}
+		req := postmanRequest{
+			Method:      e.Method,
+			Description: e.Description,
+			Header:      []postmanHeader{},
+			URL: postmanURL{
+				Raw:      "{{baseUrl}}/" + strings.Join(segments, "/"),
+				Host:     []string{"{{baseUrl}}"},
+				Path:     segments,
+				Variable: vars,
+			},
+		}
+		if strings.HasSuffix(e.Description, "(admin)") {
+			req.Header = append(req.Header, postmanHeader{Key: "Authorization", Value: "Bearer {{adminToken}}"})
+		}
+		if ex, ok := postmanExamples[e.Method+" "+e.Path]; ok {
+			b, _ := json.MarshalIndent(ex.body, "", "  ")
+			req.Header = append(req.Header, postmanHeader{Key: "Content-Type", Value: ex.contentType})
+			req.Body = &postmanBody{Mode: "raw", Raw: string(b)}
+		}
+		c.Item = append(c.Item, postmanItem{Name: e.Method + " " + e.Path, Request: req})
+	}
+	return c
+}
+
+// postmanHandler serves the Postman collection of the API, to import it
+// and try the endpoints without writing any code.
+func (s *Server) postmanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="pac-demo.postman_collection.json"`)
+	writeJSON(w, http.StatusOK, buildPostmanCollection(baseURL(r), enabledEndpoints(s.disabled)))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// projectableFields are the fields ?fields= can select, in the order of
+// Item, which is the order they are encoded in.
+var projectableFields = []string{"id", "name", "category", "value", "tags", "metadata", "created_at", "updated_at"}
+
+// fieldMask is a set of projectableFields, bit i standing for field i.
+type fieldMask uint8
+
+// fieldBit returns the bit of field name, or 0 if it cannot be projected.
+func fieldBit(name string) fieldMask {
+	for i, f := range projectableFields {
+		if f == name {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// parseFields parses a comma-separated ?fields= list. The ID is always
+// part of a projection, listed or not.
+func parseFields(v string) (fieldMask, error) {
+	mask := fieldBit("id")
+	for _, p := range strings.Split(v, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		bit := fieldBit(snakeCase(p))
+		if bit == 0 {
+			return 0, fmt.Errorf("invalid field %q, expected one of %s", p, strings.Join(projectableFields, ", "))
+		}
+		mask |= bit
+	}
+	return mask, nil
+}
+
+// sortFields returns the fields keys compare on.
+func sortFields(keys []sortKey) fieldMask {
+	var mask fieldMask
+	for _, k := range keys {
+		mask |= fieldBit(k.field)
+	}
+	return mask
+}
+
+// ItemProjection is an item restricted to some of its fields. Only the
+// fields of the copied mask are set in Item, the others are zero, and only
+// those in Fields are encoded.
+type ItemProjection struct {
+	Item
+	Fields fieldMask
+}
+
+// project returns the projection of it on fields. copied, a superset of
+// fields, lists the fields kept besides, to be sorted on for instance.
+func project(it Item, fields, copied fieldMask) ItemProjection {
+	var p Item
+	for i := range projectableFields {
+		if copied&(1<<i) == 0 {
+			continue
+		}
+		switch i {
+		case 0:
+			p.ID = it.ID
+		case 1:
+			p.Name = it.Name
+		case 2:
+			p.Category = it.Category
+		case 3:
+			p.Value = it.Value
+		case 4:
+			p.Tags = it.Tags
+		case 5:
+			p.Metadata = it.Metadata
+		case 6:
+			p.CreatedAt = it.CreatedAt
+		case 7:
+			p.UpdatedAt = it.UpdatedAt
+		}
+	}
+	return ItemProjection{Item: p, Fields: fields}
+}
+
+func (p ItemProjection) MarshalJSON() ([]byte, error) {
+	return p.marshal(p.ID)
+}
+
+// marshal encodes the fields of p, in order, with id as the ID. Empty
+// fields are left out as they are from a full Item.
+func (p ItemProjection) marshal(id any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range projectableFields {
+		if p.Fields&(1<<i) == 0 {
+			continue
+		}
+		var v any
+		switch i {
+		case 0:
+			v = id
+		case 1:
+			v = p.Name
+		case 2:
+			if p.Category == "" {
+				continue
+			}
+			v = p.Category
+		case 3:
+			v = p.Value
+		case 4:
+			if len(p.Tags) == 0 {
+				continue
+			}
+			v = p.Tags
+		case 5:
+			if len(p.Metadata) == 0 {
+				continue
+			}
+			v = p.Metadata
+		case 6:
+			v = p.CreatedAt
+		case 7:
+			v = p.UpdatedAt
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('"')
+		buf.WriteString(name)
+		buf.WriteString(`":`)
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// externalProjection is an ItemProjection with its ID replaced by a token.
+type externalProjection struct {
+	ItemProjection
+	ID string
+}
+
+func (e externalProjection) MarshalJSON() ([]byte, error) {
+	return e.ItemProjection.marshal(e.ID)
+}
+
+// sortProjections is sortItems for projections, which must hold the
+// fields of keys.
+func sortProjections(projs []ItemProjection, keys []sortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(projs, func(i, j int) bool {
+		return compareItems(projs[i].Item, projs[j].Item, keys) < 0
+	})
+}
+
+// GetProjectedByIDs is GetItemsByIDs for the items matching f, projected
+// on fields. Only the fields of copied, a superset of fields, are copied
+// out of the store, so the tags and metadata of items are not shared with
+// callers that did not ask for them.
+func (s *MemoryStore) GetProjectedByIDs(ids []int, f ItemFilter, fields, copied fieldMask) []ItemProjection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projs := make([]ItemProjection, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		s.stats.gets.Add(1)
+		if it, ok := s.items[id]; ok && f.Match(it) {
+			projs = append(projs, project(it, fields, copied|fieldBit("id")))
+		}
+	}
+	sort.Slice(projs, func(i, j int) bool { return projs[i].ID < projs[j].ID })
+	return projs
+}
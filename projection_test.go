@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// benchIDs returns the IDs 1 to n, comma-separated.
+func benchIDs(n int) string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+	return strings.Join(ids, ",")
+}
+
+// BenchmarkBatchGet measures GET /items?ids= for 1000 items, full and
+// projected on their names, and the store lookups underneath.
+func BenchmarkBatchGet(b *testing.B) {
+	s, h := newTestServer(b, nil)
+	for i := 0; i < 1000; i++ {
+		it := Item{Name: "item-" + strconv.Itoa(i), Category: "bench", Value: i, Tags: []string{"a", "b", "c"}, Metadata: map[string]string{"team": "blue"}}
+		if _, err := s.store.AddItem(it); err != nil {
+			b.Fatal(err)
+		}
+	}
+	ids := benchIDs(1000)
+	for _, path := range []string{"/items?ids=" + ids, "/items?fields=name&ids=" + ids} {
+		name := "http/full"
+		if strings.Contains(path, "fields=") {
+			name = "http/projected"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mustDo(b, h, http.StatusOK, http.MethodGet, path, "")
+			}
+		})
+	}
+
+	mem := newBenchStore(b, 1000)
+	idList := make([]int, 1000)
+	for i := range idList {
+		idList[i] = i + 1
+	}
+	fields, err := parseFields("name")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("store/full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mem.GetItemsByIDs(idList)
+		}
+	})
+	b.Run("store/projected", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mem.GetProjectedByIDs(idList, ItemFilter{}, fields, fields)
+		}
+	})
+}
+
+func TestBatchGetProjected(t *testing.T) {
+	_, h := newTestServer(t, nil)
+	for _, body := range []string{
+		`{"name":"b","category":"x","value":2,"tags":["t"]}`,
+		`{"name":"a","category":"y","value":1}`,
+		`{"name":"c","category":"x","value":3}`,
+	} {
+		mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", body)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/items?ids=3,1,3,9&fields=name", `[{"id":1,"name":"b"},{"id":3,"name":"c"}]`},
+		{"/items?ids=1,2,3&fields=name&category=x", `[{"id":1,"name":"b"},{"id":3,"name":"c"}]`},
+		{"/items?ids=1,2,3&fields=name&sort=value", `[{"id":2,"name":"a"},{"id":1,"name":"b"},{"id":3,"name":"c"}]`},
+		{"/items?ids=1,2&fields=tags", `[{"id":1,"tags":["t"]},{"id":2}]`},
+		{"/items?ids=1&fields=", `[{"id":1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := mustDo(t, h, http.StatusOK, http.MethodGet, tt.path, "")
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	rec := mustDo(t, h, http.StatusBadRequest, http.MethodGet, "/items?ids=1&fields=secret", "")
+	if !strings.Contains(rec.Body.String(), `invalid field \"secret\"`) {
+		t.Errorf("unknown field answered %s", rec.Body.String())
+	}
+}
+
+func TestGetProjectedByIDsCopiesOnlyFields(t *testing.T) {
+	s := newBenchStore(t, 3)
+	name, err := parseFields("name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range s.GetProjectedByIDs([]int{1, 2}, ItemFilter{}, name, name) {
+		if p.Tags != nil || p.Category != "" {
+			t.Errorf("item %d: fields outside the projection were copied: %+v", p.ID, p.Item)
+		}
+	}
+	copied := name | fieldBit("value")
+	projs := s.GetProjectedByIDs([]int{2}, ItemFilter{}, name, copied)
+	if len(projs) != 1 || projs[0].Value != 1 {
+		t.Fatalf("got %+v, want item 2 with its value copied", projs)
+	}
+	if b, err := projs[0].MarshalJSON(); err != nil || string(b) != `{"id":2,"name":"item-1"}` {
+		t.Errorf("encoded %s, %v", b, err)
+	}
+}
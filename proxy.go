@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// proxyMiddleware rewrites r as the client sent it to the reverse proxy in
+// front of the service, using the X-Forwarded-For, X-Forwarded-Proto and
+// X-Forwarded-Host headers that the proxy sets. Clients can send these
+// headers too, so the middleware must only be enabled when every request
+// goes through a proxy that overwrites or appends to them.
+func proxyMiddleware(trust bool, next http.Handler) http.Handler {
+	if !trust {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The proxy appends the address it received the request from, so
+		// the last entry is the only one it vouches for; earlier ones may
+		// have been made up by the client.
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			last := xff[len(xff)-1]
+			if i := strings.LastIndexByte(last, ','); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			}
+		}
+		switch proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto {
+		case "http", "https":
+			r.URL.Scheme = proto
+		}
+		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+			r.Host = host
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// baseURL returns the scheme and host under which the client reached the
+// service, such as https://items.example.com.
+func baseURL(r *http.Request) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host
+}
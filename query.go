@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// filterParams are the query parameters read by parseItemFilter. The
+// trailing dot of metadataParamPrefix accepts any meta.<key>.
+var filterParams = []string{"name", "category", "value", "min_value", "max_value", "updated_since", metadataParamPrefix}
+
+// checkQuery enforces STRICT_QUERY: when it is on, a request carrying a
+// query parameter outside allowed is answered 400, listing the unknown
+// ones, and checkQuery reports false. An allowed entry ending with a dot
+// accepts every parameter with that prefix. With STRICT_QUERY off, unknown
+// parameters are ignored as they always were.
+func (s *Server) checkQuery(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	if !s.cfg.StrictQuery {
+		return true
+	}
+	var unknown []string
+	for key := range r.URL.Query() {
+		if !queryParamAllowed(key, allowed) {
+			unknown = append(unknown, fmt.Sprintf("%q", key))
+		}
+	}
+	if len(unknown) == 0 {
+		return true
+	}
+	sort.Strings(unknown)
+	msg := "unknown query parameters " + strings.Join(unknown, ", ")
+	if len(allowed) == 0 {
+		msg += ", this endpoint takes none"
+	} else {
+		names := make([]string, len(allowed))
+		for i, a := range allowed {
+			if strings.HasSuffix(a, ".") {
+				a += "<key>"
+			}
+			names[i] = a
+		}
+		msg += ", expected " + strings.Join(names, ", ")
+	}
+	writeError(w, http.StatusBadRequest, msg)
+	return false
+}
+
+func queryParamAllowed(key string, allowed []string) bool {
+	for _, a := range allowed {
+		if key == a || (strings.HasSuffix(a, ".") && strings.HasPrefix(key, a) && len(key) > len(a)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiKeyHeader carries the API key quotas are accounted to.
+const apiKeyHeader = "X-API-Key"
+
+// Quota bounds the usage of one API key over a quota period. A zero field
+// is unlimited.
+type Quota struct {
+	Requests int
+	Bytes    int64
+}
+
+// QuotaConfig maps API keys to their quotas. Requests without a key listed
+// in Keys are accounted to their client IP address, under PerIP.
+type QuotaConfig struct {
+	Keys  map[string]Quota
+	PerIP Quota
+	// MaxAddresses caps the client addresses accounted separately over a
+	// period. Past it, further addresses share a single PerIP quota until
+	// the next reset.
+	MaxAddresses int
+	// Period is how often usage is reset.
+	Period time.Duration
+	// Headers names the request quota headers, which proxies and clients
+	// do not all agree on.
+	Headers RateLimitHeaders
+}
+
+// RateLimitHeaders names the headers reporting the request quota of a key.
+type RateLimitHeaders struct {
+	Limit     string
+	Remaining string
+	Reset     string
+}
+
+// parseQuotas parses a comma-separated list of key:requests:bytes entries.
+func parseQuotas(entries []string) (map[string]Quota, error) {
+	quotas := make(map[string]Quota, len(entries))
+	for _, e := range entries {
+		parts := strings.Split(e, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid quota %q, expected key:requests:bytes", e)
+		}
+		q, err := parseQuota(parts[1], parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w for key %q", err, parts[0])
+		}
+		quotas[parts[0]] = q
+	}
+	return quotas, nil
+}
+
+// parseQuota parses the request and byte limits of a quota.
+func parseQuota(requests, bytes string) (Quota, error) {
+	var (
+		q   Quota
+		err error
+	)
+	if q.Requests, err = strconv.Atoi(requests); err != nil || q.Requests < 0 {
+		return Quota{}, fmt.Errorf("invalid request quota %q", requests)
+	}
+	if q.Bytes, err = strconv.ParseInt(bytes, 10, 64); err != nil || q.Bytes < 0 {
+		return Quota{}, fmt.Errorf("invalid byte quota %q", bytes)
+	}
+	return q, nil
+}
+
+// overflowBucket is the usage key of the client addresses past
+// QuotaConfig.MaxAddresses.
+const overflowBucket = "ip:overflow"
+
+type quotaUsage struct {
+	requests int
+	bytes    int64
+}
+
+// quotaTracker accounts the usage of every API key and client address in
+// memory, under the keys of quotaBucket. Usage is
+// reset lazily by the first request after the period ends.
+type quotaTracker struct {
+	cfg QuotaConfig
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+	// addresses counts the client addresses in usage.
+	addresses int
+	resetAt   time.Time
+}
+
+func newQuotaTracker(cfg QuotaConfig) *quotaTracker {
+	return &quotaTracker{
+		cfg:     cfg,
+		usage:   make(map[string]*quotaUsage),
+		resetAt: time.Now().Add(cfg.Period),
+	}
+}
+
+// admit reserves one request of key declaring bodySize bytes and returns
+// the usage it counts against, or nil if the quota is exhausted. It also
+// sets the quota headers of the response, whether it is admitted or not, so
+// that clients can slow down before being refused.
+func (t *quotaTracker) admit(w http.ResponseWriter, key string, q Quota, bodySize int64) *quotaUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now := time.Now(); !now.Before(t.resetAt) {
+		t.usage = make(map[string]*quotaUsage)
+		t.addresses = 0
+		for !now.Before(t.resetAt) {
+			t.resetAt = t.resetAt.Add(t.cfg.Period)
+		}
+	}
+	u := t.usage[key]
+	if u == nil && strings.HasPrefix(key, "ip:") {
+		if t.addresses >= t.cfg.MaxAddresses {
+			key = overflowBucket
+			u = t.usage[key]
+		} else {
+			t.addresses++
+		}
+	}
+	if u == nil {
+		u = &quotaUsage{}
+		t.usage[key] = u
+	}
+
+	// A body of unknown size is admitted while bytes remain and charged
+	// once read; a declared size must fit in what remains.
+	allowed := q.Requests == 0 || u.requests < q.Requests
+	if q.Bytes > 0 && (u.bytes >= q.Bytes || u.bytes+max64(bodySize, 0) > q.Bytes) {
+		allowed = false
+	}
+	if allowed {
+		u.requests++
+	}
+
+	h := w.Header()
+	names := t.cfg.Headers
+	h.Set(names.Reset, strconv.FormatInt(t.resetAt.Unix(), 10))
+	if q.Requests > 0 {
+		h.Set(names.Limit, strconv.Itoa(q.Requests))
+		h.Set(names.Remaining, strconv.Itoa(q.Requests-u.requests))
+	}
+	if q.Bytes > 0 {
+		h.Set("X-Quota-Bytes-Limit", strconv.FormatInt(q.Bytes, 10))
+		h.Set("X-Quota-Bytes-Remaining", strconv.FormatInt(max64(q.Bytes-u.bytes, 0), 10))
+	}
+	if !allowed {
+		retry := int(time.Until(t.resetAt).Seconds()) + 1
+		h.Set("Retry-After", strconv.Itoa(retry))
+		return nil
+	}
+	return u
+}
+
+// addBytes charges n body bytes read by a request to u.
+func (t *quotaTracker) addBytes(u *quotaUsage, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u.bytes += n
+}
+
+// quotaBucket returns the usage key and quota r is accounted to: those of
+// its API key if listed in keys, or else those of its client address,
+// already rewritten by proxyMiddleware for trusted proxies. Addresses are
+// prefixed so that they cannot collide with keys.
+func quotaBucket(r *http.Request, keys map[string]Quota, perIP Quota) (string, Quota, bool) {
+	key := r.Header.Get(apiKeyHeader)
+	if q, ok := keys[key]; ok {
+		return key, q, true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host, perIP, false
+}
+
+// quotaMiddleware enforces the request and body-byte quotas of API keys,
+// and of client addresses for requests without a listed key, answering 429
+// to those that used theirs up. The quotas are read from keys on every
+// request, as they can change at runtime; usage is kept across changes.
+// The health probes are never accounted, and neither are addresses while
+// PerIP is unlimited.
+func quotaMiddleware(cfg QuotaConfig, keys func() map[string]Quota, next http.Handler) http.Handler {
+	t := newQuotaTracker(cfg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, q, listed := quotaBucket(r, keys(), cfg.PerIP)
+		if healthProbe(r.URL.Path) || (!listed && q == Quota{}) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u := t.admit(w, key, q, r.ContentLength)
+		if u == nil {
+			msg := "quota exceeded for this API key"
+			if !listed {
+				msg = "quota exceeded for this client address"
+			}
+			writeError(w, http.StatusTooManyRequests, msg)
+			return
+		}
+		body := &countingReader{r: r.Body}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, r.Body}
+		next.ServeHTTP(w, r)
+		t.addBytes(u, body.n)
+	})
+}
+
+// quotas returns the API key quotas in effect.
+func (s *Server) quotas() map[string]Quota {
+	return s.live.Load().quotas
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token, as field
+// names must be.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
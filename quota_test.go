@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuotaMiddleware(t *testing.T) {
+	cfg := QuotaConfig{
+		PerIP:        Quota{Requests: 2},
+		MaxAddresses: 10,
+		Period:       30 * 24 * time.Hour,
+		Headers:      RateLimitHeaders{Limit: "X-RateLimit-Limit", Remaining: "X-RateLimit-Remaining", Reset: "X-RateLimit-Reset"},
+	}
+	keys := map[string]Quota{"team-a": {Requests: 1}}
+	h := quotaMiddleware(cfg, func() map[string]Quota { return keys }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		key, addr     string
+		status        int
+		limit, remain string
+	}{
+		{"first of address", "", "192.0.2.1:1234", http.StatusNoContent, "2", "1"},
+		{"unlisted key counts against address", "unknown", "192.0.2.1:5678", http.StatusNoContent, "2", "0"},
+		{"address exhausted", "", "192.0.2.1:1234", http.StatusTooManyRequests, "2", "0"},
+		{"other address", "", "192.0.2.2:1234", http.StatusNoContent, "2", "1"},
+		{"listed key on exhausted address", "team-a", "192.0.2.1:1234", http.StatusNoContent, "1", "0"},
+		{"key exhausted", "team-a", "192.0.2.2:1234", http.StatusTooManyRequests, "1", "0"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.RemoteAddr = tt.addr
+		if tt.key != "" {
+			req.Header.Set(apiKeyHeader, tt.key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != tt.limit {
+			t.Errorf("%s: got limit %q, want %q", tt.name, got, tt.limit)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != tt.remain {
+			t.Errorf("%s: got remaining %q, want %q", tt.name, got, tt.remain)
+		}
+		if rec.Header().Get("X-RateLimit-Reset") == "" {
+			t.Errorf("%s: no reset header", tt.name)
+		}
+		if tt.status == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: no Retry-After header", tt.name)
+		}
+	}
+}
+
+func TestQuotaHealthProbes(t *testing.T) {
+	_, h := newTestServer(t, map[string]string{"IP_QUOTA": "1:0"})
+	mustDo(t, h, http.StatusOK, http.MethodGet, "/items", "")
+	mustDo(t, h, http.StatusTooManyRequests, http.MethodGet, "/items", "")
+	for _, path := range []string{"/healthz", "/health"} {
+		rec := mustDo(t, h, http.StatusOK, http.MethodGet, path, "")
+		if rec.Header().Get("X-RateLimit-Limit") != "" {
+			t.Errorf("%s: accounted to the quota", path)
+		}
+	}
+}
+
+func TestQuotaUnlimitedAddresses(t *testing.T) {
+	_, h := newTestServer(t, nil)
+	for i := 0; i < 3; i++ {
+		rec := mustDo(t, h, http.StatusOK, http.MethodGet, "/items", "")
+		if rec.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatal("addresses are accounted by default")
+		}
+	}
+}
+
+func TestQuotaMaxAddresses(t *testing.T) {
+	cfg := QuotaConfig{
+		PerIP:        Quota{Requests: 1},
+		MaxAddresses: 2,
+		Period:       time.Hour,
+		Headers:      RateLimitHeaders{Limit: "X-RateLimit-Limit", Remaining: "X-RateLimit-Remaining", Reset: "X-RateLimit-Reset"},
+	}
+	h := quotaMiddleware(cfg, func() map[string]Quota { return nil }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		addr   string
+		status int
+	}{
+		{"192.0.2.1:1", http.StatusNoContent},
+		{"192.0.2.2:1", http.StatusNoContent},
+		// Past the cap, addresses share the overflow quota.
+		{"192.0.2.3:1", http.StatusNoContent},
+		{"192.0.2.4:1", http.StatusTooManyRequests},
+		{"192.0.2.1:1", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.RemoteAddr = tt.addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.addr, rec.Code, tt.status)
+		}
+	}
+
+	tr := newQuotaTracker(cfg)
+	for i := 0; i < 100; i++ {
+		tr.admit(httptest.NewRecorder(), "ip:192.0.2."+strconv.Itoa(i), cfg.PerIP, 0)
+	}
+	if len(tr.usage) != cfg.MaxAddresses+1 {
+		t.Errorf("tracked %d buckets for 100 addresses, want %d", len(tr.usage), cfg.MaxAddresses+1)
+	}
+}
+
+func TestParseQuotas(t *testing.T) {
+	tests := []struct {
+		entries []string
+		want    map[string]Quota
+		wantErr bool
+	}{
+		{entries: nil, want: map[string]Quota{}},
+		{entries: []string{"a:10:0", "b:0:1024"}, want: map[string]Quota{"a": {Requests: 10}, "b": {Bytes: 1024}}},
+		{entries: []string{"a:10"}, wantErr: true},
+		{entries: []string{":10:0"}, wantErr: true},
+		{entries: []string{"a:-1:0"}, wantErr: true},
+		{entries: []string{"a:1:x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseQuotas(tt.entries)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQuotas(%q): got error %v, want error %v", tt.entries, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseQuotas(%q) = %v, want %v", tt.entries, got, tt.want)
+			continue
+		}
+		for k, q := range tt.want {
+			if got[k] != q {
+				t.Errorf("parseQuotas(%q)[%q] = %v, want %v", tt.entries, k, got[k], q)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// recordedOp is one line of a recording: a mutating store call, its
+// arguments and whether it failed.
+type recordedOp struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	ID     int       `json:"id,omitempty"`
+	Item   *Item     `json:"item,omitempty"`
+	Items  []Item    `json:"items,omitempty"`
+	Suffix bool      `json:"suffix,omitempty"`
+	Keep   int       `json:"keep,omitempty"`
+	// With is the second item of a swap.
+	With  int    `json:"with,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	opAdd             = "add"
+	opAddIfNameAbsent = "add_if_name_absent"
+	opUpdate          = "update"
+	opCopy            = "copy"
+	opDelete          = "delete"
+	opPop             = "pop"
+	opTruncate        = "truncate"
+	opUpsertByName    = "upsert_by_name"
+	opSwapValues      = "swap_values"
+)
+
+// RecordingStore is a Store decorator appending every mutating call, with
+// its arguments, to a JSON lines file that Replay can apply to another
+// store. Reads are passed through unrecorded.
+//
+// Recorded calls are serialized so that the file order is exactly the
+// order in which they were applied; this costs write concurrency and is
+// meant for debugging sessions.
+type RecordingStore struct {
+	Store
+
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// NewRecordingStore records the mutations of inner to path, appending to
+// the file if it exists.
+func NewRecordingStore(inner Store, path string) (*RecordingStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingStore{Store: inner, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Close flushes and closes the recording file.
+func (r *RecordingStore) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// record appends op, with the outcome err of the call, to the recording.
+// The caller holds r.mu.
+func (r *RecordingStore) record(op recordedOp, err error) {
+	op.Time = time.Now().UTC()
+	if err != nil {
+		op.Error = err.Error()
+	}
+	b, merr := json.Marshal(op)
+	if merr != nil {
+		return
+	}
+	r.w.Write(append(b, '\n'))
+	r.w.Flush()
+}
+
+func (r *RecordingStore) AddItem(it Item) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	created, err := r.Store.AddItem(it)
+	r.record(recordedOp{Op: opAdd, Item: &it}, err)
+	return created, err
+}
+
+func (r *RecordingStore) AddItemIfNameAbsent(it Item) (Item, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	got, created, err := r.Store.AddItemIfNameAbsent(it)
+	r.record(recordedOp{Op: opAddIfNameAbsent, Item: &it}, err)
+	return got, created, err
+}
+
+func (r *RecordingStore) UpdateItem(id int, it Item) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	updated, err := r.Store.UpdateItem(id, it)
+	r.record(recordedOp{Op: opUpdate, ID: id, Item: &it}, err)
+	return updated, err
+}
+
+// UpdateItemIf records a call that passed its precondition as a plain
+// update; one that failed it did not touch the store and is not recorded.
+// A nil precond, as for a PUT without If-Match, is passed through as is.
+func (r *RecordingStore) UpdateItemIf(id int, it Item, precond func(current Item) error) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var failed bool
+	check := precond
+	if precond != nil {
+		check = func(current Item) error {
+			if err := precond(current); err != nil {
+				failed = true
+				return err
+			}
+			return nil
+		}
+	}
+	updated, err := r.Store.UpdateItemIf(id, it, check)
+	if !failed {
+		r.record(recordedOp{Op: opUpdate, ID: id, Item: &it}, err)
+	}
+	return updated, err
+}
+
+func (r *RecordingStore) CopyItem(id int, suffix bool) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	created, err := r.Store.CopyItem(id, suffix)
+	r.record(recordedOp{Op: opCopy, ID: id, Suffix: suffix}, err)
+	return created, err
+}
+
+func (r *RecordingStore) DeleteItem(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.Store.DeleteItem(id)
+	r.record(recordedOp{Op: opDelete, ID: id}, err)
+	return err
+}
+
+func (r *RecordingStore) PopItem(id int) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	it, err := r.Store.PopItem(id)
+	r.record(recordedOp{Op: opPop, ID: id}, err)
+	return it, err
+}
+
+func (r *RecordingStore) Truncate(keep int) ([]Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed, err := r.Store.Truncate(keep)
+	r.record(recordedOp{Op: opTruncate, Keep: keep}, err)
+	return removed, err
+}
+
+func (r *RecordingStore) UpsertByName(items []Item) ([]UpsertResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// UpsertByName normalizes its argument in place, record the input.
+	in := append([]Item(nil), items...)
+	results, err := r.Store.UpsertByName(items)
+	r.record(recordedOp{Op: opUpsertByName, Items: in}, err)
+	return results, err
+}
+
+func (r *RecordingStore) SwapValues(a, b int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.Store.SwapValues(a, b)
+	r.record(recordedOp{Op: opSwapValues, ID: a, With: b}, err)
+	return err
+}
+
+// Replay applies the calls recorded in path to store, in order. Starting
+// from an empty store configured like the recorded one, it rebuilds the
+// same state, IDs included. It stops at the first call whose outcome
+// differs from the recording: one that failed when it had succeeded, or
+// the other way round.
+func Replay(store Store, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	n := 0
+	for sc.Scan() {
+		var op recordedOp
+		if err := json.Unmarshal(sc.Bytes(), &op); err != nil {
+			return n, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		err := applyOp(store, op)
+		if (err != nil) != (op.Error != "") {
+			return n, fmt.Errorf("line %d: %s: got error %v, recorded %q", n+1, op.Op, err, op.Error)
+		}
+		n++
+	}
+	return n, sc.Err()
+}
+
+func applyOp(store Store, op recordedOp) error {
+	var item Item
+	if op.Item != nil {
+		item = *op.Item
+	}
+	var err error
+	switch op.Op {
+	case opAdd:
+		_, err = store.AddItem(item)
+	case opAddIfNameAbsent:
+		_, _, err = store.AddItemIfNameAbsent(item)
+	case opUpdate:
+		_, err = store.UpdateItem(op.ID, item)
+	case opCopy:
+		_, err = store.CopyItem(op.ID, op.Suffix)
+	case opDelete:
+		err = store.DeleteItem(op.ID)
+	case opPop:
+		_, err = store.PopItem(op.ID)
+	case opTruncate:
+		_, err = store.Truncate(op.Keep)
+	case opUpsertByName:
+		_, err = store.UpsertByName(op.Items)
+	case opSwapValues:
+		err = store.SwapValues(op.ID, op.With)
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaConfig enables the read replica serving GET requests.
+type ReplicaConfig struct {
+	Enabled bool
+	// Refresh is how often the replica copies the primary store, if it
+	// changed. Zero copies it after every mutation instead.
+	Refresh time.Duration
+}
+
+// replicaSnapshot is one immutable copy of the primary store.
+type replicaSnapshot struct {
+	store *MemoryStore
+	// gen is the generation of the primary when the copy was taken.
+	gen uint64
+}
+
+// ReadReplicaStore serves reads from a copy of a primary store, replaced
+// whole on every refresh. Nothing ever writes to a copy, so readers never
+// wait for writers, at the price of staleness: a read misses the writes of
+// up to one refresh interval, plus the time a copy takes.
+type ReadReplicaStore struct {
+	primary Store
+	opts    []StoreOption
+	cfg     ReplicaConfig
+
+	snap atomic.Pointer[replicaSnapshot]
+	// changes is notified whenever a new copy is swapped in, so that long
+	// polls wake up once the replica, not just the primary, has a change.
+	changes *changeNotifier
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReadReplicaStore copies primary into stores built with opts, which
+// must configure name matching and indexes as the primary does but must not
+// include a persister, and starts refreshing the copy.
+func NewReadReplicaStore(primary Store, cfg ReplicaConfig, opts ...StoreOption) (*ReadReplicaStore, error) {
+	r := &ReadReplicaStore{
+		primary: primary,
+		opts:    opts,
+		cfg:     cfg,
+		changes: newChangeNotifier(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+func (r *ReadReplicaStore) run() {
+	defer close(r.done)
+	if r.cfg.Refresh == 0 {
+		for {
+			// As for long polls, the channel is taken before the copy so
+			// that a write during the copy is not missed.
+			changed := r.primary.Changed()
+			if err := r.refresh(); err != nil {
+				errorf("refreshing read replica: %v", err)
+			}
+			select {
+			case <-changed:
+			case <-r.stop:
+				return
+			}
+		}
+	}
+	t := time.NewTicker(r.cfg.Refresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := r.refresh(); err != nil {
+				errorf("refreshing read replica: %v", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// refresh copies the primary unless it is unchanged since the last copy.
+// The generation is read first, so that a write during the copy can only
+// make the copy look older than it is.
+func (r *ReadReplicaStore) refresh() error {
+	gen := r.primary.Generation()
+	if cur := r.snap.Load(); cur != nil && cur.gen == gen {
+		return nil
+	}
+	s, err := NewMemoryStore(r.opts...)
+	if err != nil {
+		return err
+	}
+	s.restore(snapshot{Items: r.primary.GetItems()}, func(int) {})
+	r.snap.Store(&replicaSnapshot{store: s, gen: gen})
+	r.changes.notify()
+	return nil
+}
+
+// Close stops the refreshes.
+func (r *ReadReplicaStore) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *ReadReplicaStore) current() *MemoryStore {
+	return r.snap.Load().store
+}
+
+func (r *ReadReplicaStore) GetItem(id int) (Item, error) {
+	return r.current().GetItem(id)
+}
+
+func (r *ReadReplicaStore) GetItems() []Item {
+	return r.current().GetItems()
+}
+
+func (r *ReadReplicaStore) GetItemsByIDs(ids []int) []Item {
+	return r.current().GetItemsByIDs(ids)
+}
+
+func (r *ReadReplicaStore) GetProjectedByIDs(ids []int, f ItemFilter, fields, copied fieldMask) []ItemProjection {
+	return r.current().GetProjectedByIDs(ids, f, fields, copied)
+}
+
+func (r *ReadReplicaStore) FilterItems(f ItemFilter) []Item {
+	return r.current().FilterItems(f)
+}
+
+func (r *ReadReplicaStore) FilterItemsContext(ctx context.Context, f ItemFilter) ([]Item, error) {
+	return r.current().FilterItemsContext(ctx, f)
+}
+
+func (r *ReadReplicaStore) Distinct(field string) ([]DistinctCount, error) {
+	return r.current().Distinct(field)
+}
+
+func (r *ReadReplicaStore) Group(field, none string) (map[string]ItemGroup, error) {
+	return r.current().Group(field, none)
+}
+
+func (r *ReadReplicaStore) Histogram(bounds []int) ([]HistogramBucket, error) {
+	return r.current().Histogram(bounds)
+}
+
+func (r *ReadReplicaStore) IDs() []int {
+	return r.current().IDs()
+}
+
+func (r *ReadReplicaStore) Len() int {
+	return r.current().Len()
+}
+
+func (r *ReadReplicaStore) Exists(id int) bool {
+	return r.current().Exists(id)
+}
+
+func (r *ReadReplicaStore) MaxItem() (Item, error) {
+	return r.current().MaxItem()
+}
+
+func (r *ReadReplicaStore) MinItem() (Item, error) {
+	return r.current().MinItem()
+}
+
+func (r *ReadReplicaStore) Changed() <-chan struct{} {
+	return r.changes.wait()
+}
+
+// Generation is the generation of the primary the current copy was taken
+// at, so that ETags and long polls describe what the replica serves.
+func (r *ReadReplicaStore) Generation() uint64 {
+	return r.snap.Load().gen
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader carries the correlation ID of a request, in both
+// directions.
+const requestIDHeader = "X-Request-ID"
+
+// RequestIDConfig selects how request IDs are generated and which client
+// IDs are accepted.
+type RequestIDConfig struct {
+	// Format is one of uuid, ulid and hex.
+	Format string
+	// HexLength is the number of hex digits of the hex format.
+	HexLength int
+	// MaxLength bounds the IDs accepted from clients.
+	MaxLength int
+}
+
+// IDGenerator makes new request IDs.
+type IDGenerator interface {
+	NewID() string
+}
+
+// newIDGenerator returns the generator of the configured format.
+func newIDGenerator(c RequestIDConfig) (IDGenerator, error) {
+	switch c.Format {
+	case "uuid":
+		return uuidGenerator{}, nil
+	case "ulid":
+		return ulidGenerator{}, nil
+	case "hex":
+		if c.HexLength < 1 {
+			return nil, fmt.Errorf("hex request ID length must be positive, got %d", c.HexLength)
+		}
+		return hexGenerator{length: c.HexLength}, nil
+	default:
+		return nil, fmt.Errorf("invalid request ID format %q, expected uuid, ulid or hex", c.Format)
+	}
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// uuidGenerator makes random version 4 UUIDs.
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string {
+	var b [16]byte
+	randomBytes(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ulidGenerator makes ULIDs: a millisecond timestamp followed by 80
+// random bits, in Crockford's base32, so that IDs sort by creation time.
+type ulidGenerator struct{}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (ulidGenerator) NewID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	randomBytes(b[6:])
+
+	// 26 characters of 5 bits hold the 128 bits, with 2 leading zero
+	// bits in the first character.
+	hi, lo := binary.BigEndian.Uint64(b[0:8]), binary.BigEndian.Uint64(b[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// hexGenerator makes random IDs of length hex digits.
+type hexGenerator struct {
+	length int
+}
+
+func (g hexGenerator) NewID() string {
+	b := make([]byte, (g.length+1)/2)
+	randomBytes(b)
+	return hex.EncodeToString(b)[:g.length]
+}
+
+// validRequestID reports whether a client-supplied ID can be used as is.
+// IDs end up in logs, so they are limited in length and to characters that
+// cannot forge log lines.
+func validRequestID(id string, max int) bool {
+	if id == "" || len(id) > max {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+type requestIDKey struct{}
+
+// requestID returns the correlation ID of the request ctx belongs to, or
+// "-" outside of requests.
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// requestIDMiddleware gives every request a correlation ID: the one sent
+// by the client in X-Request-ID if it is valid, or a new one. The ID is
+// echoed in the response and available to handlers through requestID.
+func requestIDMiddleware(c RequestIDConfig, gen IDGenerator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id, c.MaxLength) {
+			id = gen.NewID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
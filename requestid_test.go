@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		cfg     RequestIDConfig
+		pattern string
+	}{
+		{RequestIDConfig{Format: "uuid"}, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{RequestIDConfig{Format: "ulid"}, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{RequestIDConfig{Format: "hex", HexLength: 16}, `^[0-9a-f]{16}$`},
+		{RequestIDConfig{Format: "hex", HexLength: 7}, `^[0-9a-f]{7}$`},
+	}
+	for _, tt := range tests {
+		gen, err := newIDGenerator(tt.cfg)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.cfg, err)
+			continue
+		}
+		re := regexp.MustCompile(tt.pattern)
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			id := gen.NewID()
+			if !re.MatchString(id) {
+				t.Errorf("%s generated %q, want it to match %s", tt.cfg.Format, id, tt.pattern)
+			}
+			if seen[id] {
+				t.Errorf("%s generated %q twice", tt.cfg.Format, id)
+			}
+			seen[id] = true
+		}
+	}
+	for _, cfg := range []RequestIDConfig{{Format: "snowflake"}, {Format: "hex"}} {
+		if _, err := newIDGenerator(cfg); err == nil {
+			t.Errorf("%+v was accepted", cfg)
+		}
+	}
+}
+
+func TestULIDOrder(t *testing.T) {
+	gen := ulidGenerator{}
+	a := gen.NewID()
+	time.Sleep(2 * time.Millisecond)
+	if b := gen.NewID(); b <= a {
+		t.Errorf("ULID %s generated after %s sorts before it", b, a)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	cfg := RequestIDConfig{Format: "hex", HexLength: 8, MaxLength: 16}
+	var seen string
+	h := requestIDMiddleware(cfg, hexGenerator{length: 8}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+	}))
+	tests := []struct {
+		name, sent string
+		kept       bool
+	}{
+		{"none", "", false},
+		{"valid", "abc-123_x.y:z", true},
+		{"at the limit", strings.Repeat("a", 16), true},
+		{"too long", strings.Repeat("a", 17), false},
+		{"newline", "abc\nINFO forged", false},
+		{"space", "abc def", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.sent != "" {
+			req.Header.Set(requestIDHeader, tt.sent)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		got := rec.Header().Get(requestIDHeader)
+		if got != seen {
+			t.Errorf("%s: echoed %q, handlers saw %q", tt.name, got, seen)
+		}
+		if tt.kept != (got == tt.sent) {
+			t.Errorf("%s: sent %q, got %q", tt.name, tt.sent, got)
+		}
+		if !tt.kept && len(got) != 8 {
+			t.Errorf("%s: generated %q, want 8 hex digits", tt.name, got)
+		}
+	}
+	if id := requestID(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "-" {
+		t.Errorf("requestID outside of a request = %q, want -", id)
+	}
+}
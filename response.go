@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		warnf("encoding response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// envelope wraps successful payloads when the envelope mode is on.
+type envelope struct {
+	Data any            `json:"data"`
+	Meta map[string]any `json:"meta"`
+}
+
+// writeData writes the payload of a successful item response, wrapped in an
+// envelope with meta when the client or the configuration asks for it.
+// Errors keep their bare {"error": ...} form either way.
+func (s *Server) writeData(w http.ResponseWriter, r *http.Request, status int, data any, meta map[string]any) {
+	data = s.externalize(data)
+	if !s.cfg.Envelope && !acceptsProfile(r, envelopeProfile) {
+		writeJSON(w, status, data)
+		return
+	}
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	writeJSON(w, status, envelope{Data: data, Meta: meta})
+}
+
+// preferReturn returns the return preference of r, "minimal" or
+// "representation", from its Prefer headers (RFC 7240), or "" when there is
+// none.
+func preferReturn(r *http.Request) string {
+	for _, h := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(h, ",") {
+			pref, _, _ = strings.Cut(pref, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "return") {
+				continue
+			}
+			switch value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`)); value {
+			case "minimal", "representation":
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// writeItemResult answers a successful write of it, honouring the return
+// preference: "Prefer: return=minimal" leaves the body out, keeping 201 or
+// turning 200 into 204, while return=representation, the default, sends
+// the item. Location and ETag tell a minimal client all it needs to
+// follow up. An explicit preference is echoed in Preference-Applied.
+func (s *Server) writeItemResult(w http.ResponseWriter, r *http.Request, status int, it Item) {
+	pref := preferReturn(r)
+	if pref != "" {
+		w.Header().Set("Preference-Applied", "return="+pref)
+	}
+	if pref != "minimal" {
+		s.writeData(w, r, status, it, nil)
+		return
+	}
+	if status == http.StatusOK {
+		status = http.StatusNoContent
+	}
+	w.WriteHeader(status)
+}
+
+// checkContentType verifies that the request body is declared as one of the
+// allowed media types. A charset parameter is accepted as long as it is
+// UTF-8.
+func checkContentType(r *http.Request, allowed ...string) error {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return fmt.Errorf("missing Content-Type, expected %s", strings.Join(allowed, " or "))
+	}
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q", ct)
+	}
+	if cs, ok := params["charset"]; ok && !strings.EqualFold(cs, "utf-8") {
+		return fmt.Errorf("unsupported charset %q, expected utf-8", cs)
+	}
+	for _, a := range allowed {
+		if mediaType == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported Content-Type %q, expected %s", mediaType, strings.Join(allowed, " or "))
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields,
+// bodies larger than maxBytes and bodies exceeding lim.
+func decodeJSON(w http.ResponseWriter, r *http.Request, maxBytes int64, lim JSONLimits, v any) error {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		return err
+	}
+	return lim.decode(b, v)
+}
+
+// Policies for answering an empty list, see writeList.
+const (
+	emptyListArray     = "array"
+	emptyListNull      = "null"
+	emptyListNoContent = "204"
+)
+
+// writeList answers with list, a slice of n entries, applying the
+// configured empty-list policy when n is zero: [] by default, null, or a
+// bodiless 204. A nil slice is always written as []. meta, which may be
+// nil, is added to the envelope meta next to the count.
+func (s *Server) writeList(w http.ResponseWriter, r *http.Request, list any, n int, meta map[string]any) {
+	if n == 0 {
+		switch s.cfg.EmptyList {
+		case emptyListNull:
+			list = nil
+		case emptyListNoContent:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			list = []struct{}{}
+		}
+	}
+	if meta == nil {
+		meta = make(map[string]any, 1)
+	}
+	meta["count"] = n
+	s.writeData(w, r, http.StatusOK, list, meta)
+}
+
+// describeDecodeError rewrites the type errors of encoding/json, which
+// name Go types, into messages about the JSON field. Numbers are never
+// coerced: a fractional, exponent or out-of-range value for an integer
+// field is rejected rather than truncated.
+func describeDecodeError(err error) error {
+	var terr *json.UnmarshalTypeError
+	if !errors.As(err, &terr) || terr.Field == "" {
+		return err
+	}
+	got := terr.Value
+	if lit := strings.TrimPrefix(got, "number "); lit != got {
+		if terr.Type.Kind() >= reflect.Int && terr.Type.Kind() <= reflect.Uint64 {
+			if strings.Trim(lit, "-0123456789") == "" {
+				return fmt.Errorf("%s %s is out of range", terr.Field, lit)
+			}
+			return fmt.Errorf("%s must be an integer, got %s", terr.Field, lit)
+		}
+		got = lit
+	}
+	return fmt.Errorf("%s must be %s, got %s", terr.Field, jsonKind(terr.Type), got)
+}
+
+// jsonKind names the JSON value expected for a Go type.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// decodeBody is the entry point of every write handler reading a JSON body:
+// it answers 415 for a non-JSON Content-Type and 400 for an undecodable
+// body, and reports whether the handler should carry on.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := checkContentType(r, "application/json"); err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return false
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes))
+	if err == nil {
+		b, err = s.internalizeIDs(b)
+	}
+	if err == nil {
+		err = s.cfg.JSONLimits.decode(b, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", describeDecodeError(err)))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreferReturn(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    string
+	}{
+		{nil, ""},
+		{[]string{"return=minimal"}, "minimal"},
+		{[]string{"return=representation"}, "representation"},
+		{[]string{`Return="Minimal"`}, "minimal"},
+		{[]string{"respond-async, return=minimal; foo=bar"}, "minimal"},
+		{[]string{"wait=10", "return=representation"}, "representation"},
+		{[]string{"return=bogus"}, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/items", nil)
+		for _, h := range tt.headers {
+			r.Header.Add("Prefer", h)
+		}
+		if got := preferReturn(r); got != tt.want {
+			t.Errorf("preferReturn(%q) = %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestWriteItemResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers []string
+		status  int
+		applied string
+		empty   bool
+	}{
+		{"create", http.MethodPost, "/items", `{"name":"b","value":1}`, nil, http.StatusCreated, "", false},
+		{"create minimal", http.MethodPost, "/items", `{"name":"c","value":1}`, []string{"Prefer", "return=minimal"}, http.StatusCreated, "return=minimal", true},
+		{"replace representation", http.MethodPut, "/items/1", `{"name":"a","value":2}`, []string{"Prefer", "return=representation"}, http.StatusOK, "return=representation", false},
+		{"replace minimal", http.MethodPut, "/items/1", `{"name":"a","value":3}`, []string{"Prefer", "return=minimal"}, http.StatusNoContent, "return=minimal", true},
+		{"patch minimal", http.MethodPatch, "/items/1", `{"value":4}`, []string{"Prefer", "return=minimal", "Content-Type", "application/merge-patch+json"}, http.StatusNoContent, "return=minimal", true},
+		{"copy", http.MethodPost, "/items/1/copy", "", nil, http.StatusCreated, "", false},
+		{"copy minimal", http.MethodPost, "/items/1/copy", "", []string{"Prefer", "return=minimal"}, http.StatusCreated, "return=minimal", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h := newTestServer(t, nil)
+			mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"a","value":1}`)
+			rec := mustDo(t, h, tt.status, tt.method, tt.path, tt.body, tt.headers...)
+			if got := rec.Header().Get("Preference-Applied"); got != tt.applied {
+				t.Errorf("got Preference-Applied %q, want %q", got, tt.applied)
+			}
+			if body := rec.Body.String(); tt.empty != (body == "") {
+				t.Errorf("got body %q", body)
+			} else if !tt.empty && !strings.Contains(body, `"created_at"`) {
+				t.Errorf("body %s is not the item", body)
+			}
+			if tt.status == http.StatusCreated && rec.Header().Get("Location") == "" {
+				t.Error("no Location header")
+			}
+		})
+	}
+}
+
+func TestStrictNumbers(t *testing.T) {
+	tests := []struct {
+		value  string
+		status int
+		want   string
+	}{
+		{"3", http.StatusCreated, `"value":3`},
+		{"3.0", http.StatusBadRequest, "value must be an integer, got 3.0"},
+		{"3.5", http.StatusBadRequest, "value must be an integer, got 3.5"},
+		{"1e3", http.StatusBadRequest, "value must be an integer, got 1e3"},
+		{"99999999999999999999", http.StatusBadRequest, "value 99999999999999999999 is out of range"},
+		{"-99999999999999999999", http.StatusBadRequest, "value -99999999999999999999 is out of range"},
+		{`"3"`, http.StatusBadRequest, "value must be an integer, got string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, h := newTestServer(t, nil)
+			rec := mustDo(t, h, tt.status, http.MethodPost, "/items", `{"name":"a","value":`+tt.value+`}`)
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("got %s, want it to contain %q", rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyList(t *testing.T) {
+	paths := []string{
+		"/items",
+		"/items?category=none",
+		"/items?fields=name",
+		"/items/distinct?field=tags",
+		"/items/distinct?field=category&with_counts=true",
+	}
+	tests := []struct {
+		policy string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, "[]"},
+		{"array", http.StatusOK, "[]"},
+		{"null", http.StatusOK, "null"},
+		{"204", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			var env map[string]string
+			if tt.policy != "" {
+				env = map[string]string{"EMPTY_LIST": tt.policy}
+			}
+			_, h := newTestServer(t, env)
+			for _, path := range paths {
+				rec := mustDo(t, h, tt.status, http.MethodGet, path, "")
+				if got := strings.TrimSpace(rec.Body.String()); got != tt.body {
+					t.Errorf("%s: got body %q, want %q", path, got, tt.body)
+				}
+			}
+			// A listing with results is not affected.
+			mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"a","value":1,"category":"c"}`)
+			if rec := mustDo(t, h, http.StatusOK, http.MethodGet, "/items", ""); !strings.HasPrefix(rec.Body.String(), "[{") {
+				t.Errorf("got %s, want the item", rec.Body.String())
+			}
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("EMPTY_LIST", "nothing")
+		if _, err := loadConfig(); err == nil {
+			t.Error("EMPTY_LIST=nothing was accepted")
+		}
+	})
+}
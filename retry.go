@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryConfig bounds how handlers retry idempotent store calls failing
+// with ErrTransient. Attempts counts the first call; 1 disables retries.
+type RetryConfig struct {
+	Attempts int
+	// Backoff is the wait before the first retry, doubled before each
+	// further one.
+	Backoff time.Duration
+}
+
+// retriedPrecond is precond for the retries of an update writing want. The
+// attempt that failed transiently may have been applied all the same, and
+// the item then fails precond only because it already holds want: such an
+// item is let through, so that the retry answers as the first attempt
+// would have instead of 412.
+func retriedPrecond(precond func(Item) error, want Item) func(Item) error {
+	if precond == nil {
+		return nil
+	}
+	etag := contentETag(want)
+	return func(current Item) error {
+		if contentETag(current) == etag {
+			return nil
+		}
+		return precond(current)
+	}
+}
+
+// retryStore calls fn until it succeeds, fails with an error other than
+// ErrTransient, runs out of attempts or ctx is done, and returns its last
+// error. Only idempotent calls may go through it: a call that took effect
+// but still reported a transient failure is made again.
+func (s *Server) retryStore(ctx context.Context, fn func() error) error {
+	delay := s.cfg.StoreRetry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !errors.Is(err, ErrTransient) || attempt >= s.cfg.StoreRetry.Attempts {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		delay *= 2
+	}
+}
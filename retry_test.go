@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyStore is a Store whose first failures calls to UpdateItemIf and
+// GetItem fail with ErrTransient; with applied, the failing updates are
+// made all the same, as when a backend commits but its answer is lost.
+type flakyStore struct {
+	Store
+	failures int32
+	applied  bool
+	calls    atomic.Int32
+}
+
+func (f *flakyStore) fail() bool {
+	return f.calls.Add(1) <= f.failures
+}
+
+func (f *flakyStore) UpdateItemIf(id int, it Item, precond func(Item) error) (Item, error) {
+	if !f.fail() {
+		return f.Store.UpdateItemIf(id, it, precond)
+	}
+	if f.applied {
+		if _, err := f.Store.UpdateItemIf(id, it, precond); err != nil {
+			return Item{}, err
+		}
+	}
+	return Item{}, fmt.Errorf("backend: connection lost: %w", ErrTransient)
+}
+
+func (f *flakyStore) GetItem(id int) (Item, error) {
+	if f.fail() {
+		return Item{}, fmt.Errorf("backend: connection lost: %w", ErrTransient)
+	}
+	return f.Store.GetItem(id)
+}
+
+func TestRetryStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		applied  bool
+		ifMatch  bool
+		status   int
+		calls    int32
+	}{
+		{"update retried", 1, false, false, http.StatusOK, 2},
+		{"conditional update retried", 1, false, true, http.StatusOK, 2},
+		{"applied conditional update retried", 1, true, true, http.StatusOK, 2},
+		{"applied update retried", 2, true, false, http.StatusOK, 3},
+		{"attempts exhausted", 3, false, true, http.StatusServiceUnavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, h := newTestServer(t, map[string]string{"STORE_RETRY_ATTEMPTS": "3", "STORE_RETRY_BACKOFF": "1ms"})
+			etag := mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3}`).Header().Get("ETag")
+			store := &flakyStore{Store: s.store, failures: tt.failures, applied: tt.applied}
+			h = newServer(s.cfg, store, nil, nil).routes()
+
+			var headers []string
+			if tt.ifMatch {
+				headers = []string{"If-Match", etag}
+			}
+			rec := mustDo(t, h, tt.status, http.MethodPut, "/items/1", `{"name":"widget","value":4}`, headers...)
+			if got := store.calls.Load(); got != tt.calls {
+				t.Errorf("got %d store calls, want %d", got, tt.calls)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(rec.Body.String(), `"value":4`) {
+				t.Errorf("got %s, want the updated item", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRetryStoreStillChecksPreconditions(t *testing.T) {
+	s, h := newTestServer(t, map[string]string{"STORE_RETRY_BACKOFF": "1ms"})
+	etag := mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3}`).Header().Get("ETag")
+	mustDo(t, h, http.StatusOK, http.MethodPut, "/items/1", `{"name":"widget","value":5}`)
+	store := &flakyStore{Store: s.store, failures: 1}
+	h = newServer(s.cfg, store, nil, nil).routes()
+	mustDo(t, h, http.StatusPreconditionFailed, http.MethodPut, "/items/1", `{"name":"widget","value":4}`, "If-Match", etag)
+}
+
+func TestRetryStoreReads(t *testing.T) {
+	s, h := newTestServer(t, map[string]string{"STORE_RETRY_BACKOFF": "1ms"})
+	mustDo(t, h, http.StatusCreated, http.MethodPost, "/items", `{"name":"widget","value":3}`)
+	store := &flakyStore{Store: s.store, failures: 2}
+	h = newServer(s.cfg, store, nil, nil).routes()
+	mustDo(t, h, http.StatusOK, http.MethodGet, "/items/1", "")
+
+	cfg := s.cfg
+	cfg.StoreRetry.Attempts = 1
+	store = &flakyStore{Store: s.store, failures: 1}
+	h = newServer(cfg, store, nil, nil).routes()
+	mustDo(t, h, http.StatusServiceUnavailable, http.MethodGet, "/items/1", "")
+	if got := store.calls.Load(); got != 1 {
+		t.Errorf("got %d calls with retries disabled, want 1", got)
+	}
+}
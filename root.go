@@ -0,0 +1,74 @@
+package main
+
+import "net/http"
+
+// endpoint describes one route for the index served at the root path.
+type endpoint struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+var endpoints = []endpoint{
+	{http.MethodGet, "/healthz", "Liveness probe"},
+	{http.MethodGet, "/health", "Service status, 503 while the store loads"},
+	{http.MethodGet, "/postman.json", "Postman collection of these endpoints"},
+	{http.MethodGet, "/items", "List items, filtered by ids, name, category, value, min_value, max_value and meta.<key>; fields= projects them; as=map keys them by ID; wait and since long-poll for a change"},
+	{http.MethodPost, "/items", "Create an item"},
+	{http.MethodGet, "/items/{id}", "Get one item"},
+	{http.MethodPut, "/items/{id}", "Replace an item"},
+	{http.MethodPatch, "/items/{id}", "Update an item with a JSON merge patch"},
+	{http.MethodDelete, "/items/{id}", "Delete an item"},
+	{http.MethodGet, "/items/{id}/exists", "Report whether an item exists"},
+	{http.MethodPost, "/items/{id}/copy", "Duplicate an item"},
+	{http.MethodPost, "/items/{id}/pop", "Delete an item and return it"},
+	{http.MethodPost, "/items/{id}/increment", "Add ?by= to the value of an item"},
+	{http.MethodGet, "/items/{id}/value", "Get the value of an item"},
+	{http.MethodPut, "/items/{id}/value", "Set the value of an item"},
+	{http.MethodGet, "/items/max", "Item with the highest value"},
+	{http.MethodGet, "/items/min", "Item with the lowest value"},
+	{http.MethodGet, "/items/export.{csv,json,jsonl}", "Export the filtered items"},
+	{http.MethodPost, "/items/batch", "Import a JSON array, or NDJSON lines, of items"},
+	{http.MethodGet, "/items/distinct", "Distinct values of field=category or field=tags, optionally with_counts"},
+	{http.MethodGet, "/items/grouped", "Items grouped by=category or by=tags, with a count per group"},
+	{http.MethodPost, "/items/import/validate", "Validate a CSV of items, in the export format, row by row, without storing anything"},
+	{http.MethodGet, "/items/histogram", "Number of items per value range, with ranges delimited by buckets=0,10,100"},
+	{http.MethodGet, "/items/diff", "Field-by-field differences between items from and to"},
+	{http.MethodPost, "/items/swap", "Exchange the values of items a and b atomically"},
+	{http.MethodPost, "/items/validate", "Validate an item without storing it"},
+	{http.MethodPost, "/items/bulk-upsert-by-name", "Create or update items keyed by name"},
+	{http.MethodGet, "/metrics", "Request, store and event counters in the OpenMetrics text format"},
+	{http.MethodGet, "/admin/metrics", "Store operation counters (admin)"},
+	{http.MethodGet, "/admin/backup", "Download every item as gzipped JSON lines, fingerprinted in trailers (admin)"},
+	{http.MethodGet, "/admin/config", "Effective settings, secrets redacted (admin)"},
+	{http.MethodPost, "/admin/config", "Change the reloadable settings at runtime (admin)"},
+	{http.MethodGet, "/admin/export", "Dump every item with a checksummed manifest (admin)"},
+	{http.MethodGet, "/admin/fingerprint", "Order-independent hash of the store contents; content=true ignores IDs and timestamps (admin)"},
+	{http.MethodPost, "/admin/flush", "Force the store to disk (admin)"},
+	{http.MethodPost, "/admin/import", "Add the items of a dump after verifying its manifest (admin)"},
+	{http.MethodPost, "/admin/truncate", "Keep only the keep most recent items (admin)"},
+	{http.MethodPost, "/admin/reindex", "Rebuild the store indexes (admin)"},
+	{http.MethodPost, "/admin/shutdown", "Shut the server down gracefully, with confirm=true (admin)"},
+}
+
+// rootHandler answers "/" with an index of the API, or redirects to
+// ROOT_REDIRECT when configured. Any other path unmatched by the more
+// specific routes is a 404.
+func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	if s.cfg.RootRedirect != "" {
+		http.Redirect(w, r, s.cfg.RootRedirect, http.StatusFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"endpoints": enabledEndpoints(s.disabled)})
+}
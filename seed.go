@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Seed adds the items of the JSON array in path to store. Every item is
+// validated before any is added, so a malformed or invalid file leaves
+// the store untouched. It returns the number of items added.
+func Seed(store Store, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var items []Item
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&items); err != nil {
+		return 0, fmt.Errorf("decoding: %w", describeDecodeError(err))
+	}
+	for i, it := range items {
+		if _, err := store.ValidateItem(it); err != nil {
+			return 0, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	for i, it := range items {
+		if _, err := store.AddItem(it); err != nil {
+			return i, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	return len(items), nil
+}
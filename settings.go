@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// secretSettings are the settings GET /admin/config redacts: credentials,
+// and lists that embed them, such as API keys or webhook URLs with tokens.
+var secretSettings = map[string]bool{
+	"ADMIN_TOKEN":    true,
+	"API_KEY_QUOTAS": true,
+	"ID_SALT":        true,
+	"WEBHOOK_URLS":   true,
+}
+
+// reloadableSettings are the settings POST /admin/config can change while
+// the server runs. The others are applied once, at startup.
+var reloadableSettings = map[string]bool{
+	"API_KEY_QUOTAS": true,
+	"CACHE_MAX_AGE":  true,
+	"LOG_LEVEL":      true,
+	"READ_ONLY":      true,
+}
+
+// liveSettings are the reloadable settings in effect, parsed, along with
+// the text of every setting. They are replaced as a whole, never modified.
+type liveSettings struct {
+	settings    map[string]string
+	readOnly    bool
+	cacheMaxAge int
+	quotas      map[string]Quota
+	logLevel    logLevel
+}
+
+func newLiveSettings(cfg Config) *liveSettings {
+	return &liveSettings{
+		settings:    cfg.Settings,
+		readOnly:    cfg.ReadOnly,
+		cacheMaxAge: cfg.CacheMaxAge,
+		quotas:      cfg.Quota.Keys,
+		logLevel:    cfg.LogLevel,
+	}
+}
+
+// with returns a copy of l with the settings of updates applied, or an
+// error naming the first one that is unknown, not reloadable or invalid.
+func (l *liveSettings) with(updates map[string]string) (*liveSettings, error) {
+	next := *l
+	next.settings = make(map[string]string, len(l.settings))
+	for k, v := range l.settings {
+		next.settings[k] = v
+	}
+	for _, k := range sortedKeys(updates) {
+		v := updates[k]
+		if _, ok := l.settings[k]; !ok {
+			return nil, fmt.Errorf("unknown setting %q", k)
+		}
+		if !reloadableSettings[k] {
+			return nil, fmt.Errorf("%s cannot be changed at runtime, restart the server with it set instead", k)
+		}
+		var err error
+		switch k {
+		case "READ_ONLY":
+			if next.readOnly, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", k, v, err)
+			}
+			v = strconv.FormatBool(next.readOnly)
+		case "CACHE_MAX_AGE":
+			if next.cacheMaxAge, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", k, v, err)
+			}
+			if next.cacheMaxAge < 0 {
+				return nil, fmt.Errorf("CACHE_MAX_AGE must not be negative, got %d", next.cacheMaxAge)
+			}
+			v = strconv.Itoa(next.cacheMaxAge)
+		case "LOG_LEVEL":
+			if next.logLevel, err = parseLogLevel(v); err != nil {
+				return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+			}
+			v = next.logLevel.String()
+		case "API_KEY_QUOTAS":
+			if next.quotas, err = parseQuotas(splitList(v)); err != nil {
+				return nil, fmt.Errorf("invalid API_KEY_QUOTAS: %w", err)
+			}
+		}
+		next.settings[k] = v
+	}
+	return &next, nil
+}
+
+// redactedSettings returns the settings of l with the secret ones that are
+// set replaced.
+func (l *liveSettings) redactedSettings() map[string]string {
+	out := make(map[string]string, len(l.settings))
+	for k, v := range l.settings {
+		out[k] = displaySetting(k, v)
+	}
+	return out
+}
+
+func displaySetting(key, v string) string {
+	if secretSettings[key] && v != "" {
+		return redacted
+	}
+	return v
+}
+
+// adminConfigHandler serves /admin/config. GET answers the effective
+// settings, by environment variable, with the secret ones redacted; POST
+// changes the reloadable ones, all or none, and answers the same.
+func (s *Server) adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		var body struct {
+			Settings map[string]string `json:"settings"`
+		}
+		if !s.decodeBody(w, r, &body) {
+			return
+		}
+		s.liveMu.Lock()
+		cur := s.live.Load()
+		next, err := cur.with(body.Settings)
+		if err != nil {
+			s.liveMu.Unlock()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.live.Store(next)
+		setLogLevel(next.logLevel)
+		s.liveMu.Unlock()
+		for _, k := range sortedKeys(body.Settings) {
+			if old, v := cur.settings[k], next.settings[k]; old != v {
+				auditf("config: %s changed from %q to %q by %s (request %s)", k, displaySetting(k, old), displaySetting(k, v), r.RemoteAddr, requestID(r.Context()))
+			}
+		}
+	}
+	reloadable := make([]string, 0, len(reloadableSettings))
+	for k := range reloadableSettings {
+		reloadable = append(reloadable, k)
+	}
+	sort.Strings(reloadable)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"settings":   s.live.Load().redactedSettings(),
+		"reloadable": reloadable,
+	})
+}
+
+// readOnlyMiddleware refuses the writes of clients, with 503, while the
+// read-only setting is on. The admin endpoints stay writable, so that it
+// can be turned off again.
+func readOnlyMiddleware(live func() *liveSettings, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if live().readOnly && !strings.HasPrefix(r.URL.Path, "/admin/") {
+				writeError(w, http.StatusServiceUnavailable, "the server is read-only")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestLoadConfigSettings(t *testing.T) {
+	t.Setenv("ADDR", ":9090")
+	first, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ADDR", "")
+	second, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := first.Settings["ADDR"]; got != ":9090" {
+		t.Errorf("got ADDR %q, want :9090", got)
+	}
+	if got := second.Settings["ADDR"]; got != ":8080" {
+		t.Errorf("got ADDR %q, want the default :8080", got)
+	}
+	second.Settings["ADDR"] = "changed"
+	if got := first.Settings["ADDR"]; got != ":9090" {
+		t.Errorf("loads share their settings: got ADDR %q", got)
+	}
+}
+
+func TestAdminConfigPerServer(t *testing.T) {
+	auth := []string{"Authorization", "Bearer secret"}
+	env := map[string]string{"ADMIN_TOKEN": "secret"}
+	_, a := newTestServer(t, env)
+	_, b := newTestServer(t, env)
+
+	mustDo(t, a, http.StatusOK, http.MethodPost, "/admin/config", `{"settings": {"READ_ONLY": "true"}}`, auth...)
+	mustDo(t, a, http.StatusServiceUnavailable, http.MethodPost, "/items", `{"name": "a"}`)
+	mustDo(t, b, http.StatusCreated, http.MethodPost, "/items", `{"name": "b"}`)
+
+	for _, tt := range []struct {
+		name string
+		h    http.Handler
+		want string
+	}{
+		{"changed", a, "true"},
+		{"other server", b, "false"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := mustDo(t, tt.h, http.StatusOK, http.MethodGet, "/admin/config", "", auth...)
+			var body struct {
+				Settings map[string]string `json:"settings"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := body.Settings["READ_ONLY"]; got != tt.want {
+				t.Errorf("got READ_ONLY %q, want %q", got, tt.want)
+			}
+			if got := body.Settings["ADMIN_TOKEN"]; got != redacted {
+				t.Errorf("got ADMIN_TOKEN %q, want it redacted", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// shardReplicas is the number of points each shard gets on the hash ring;
+// more points spread the IDs more evenly.
+const shardReplicas = 128
+
+// ShardedRouter is a Store spreading items over several MemoryStore
+// shards. Each ID is routed to one shard by consistent hashing, so reading
+// or writing an item touches a single shard, while listings fan out to all
+// of them and are merged by ID.
+//
+// The router assigns IDs itself; the ID sequences of the shards are not
+// used. Writes are serialized by the router so that the rules spanning
+// shards, unique names in particular, hold. Readers may however see a
+// write touching several items, such as an upsert batch, a swap across
+// shards or a rolled back transaction, half applied. The shards must be
+// configured alike, and cannot be persisted.
+type ShardedRouter struct {
+	shards []*MemoryStore
+	ring   []ringPoint
+	// changes is shared by the shards, so that a mutation of any of them
+	// wakes up the waiters of Changed.
+	changes *changeNotifier
+
+	// mu serializes writes; nextID is guarded by it.
+	mu     sync.Mutex
+	nextID int
+	idStep int
+}
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// NewShardedRouter routes items over shards, assigning IDs start,
+// start+step, start+2*step, and so on.
+func NewShardedRouter(start, step int, shards ...*MemoryStore) (*ShardedRouter, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("a sharded store needs at least one shard")
+	}
+	if start < 1 {
+		return nil, fmt.Errorf("id start must be at least 1, got %d", start)
+	}
+	if step < 1 {
+		return nil, fmt.Errorf("id step must be at least 1, got %d", step)
+	}
+	for i, s := range shards {
+		if s.persister != nil {
+			return nil, fmt.Errorf("shard %d is persisted, sharded stores cannot be", i)
+		}
+	}
+	r := &ShardedRouter{shards: shards, nextID: start, idStep: step, changes: newChangeNotifier()}
+	for _, s := range shards {
+		s.changes = r.changes
+	}
+	for i := range shards {
+		for v := 0; v < shardReplicas; v++ {
+			r.ring = append(r.ring, ringPoint{hash: ringHash([]byte(strconv.Itoa(i) + "/" + strconv.Itoa(v))), shard: i})
+		}
+	}
+	sort.Slice(r.ring, func(i, j int) bool { return r.ring[i].hash < r.ring[j].hash })
+	return r, nil
+}
+
+// ringHash is FNV-1a followed by the murmur3 finalizer, which spreads the
+// close inputs that IDs are over the whole ring.
+func ringHash(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// shard returns the shard owning id: the first ring point at or after the
+// hash of id, wrapping around.
+func (r *ShardedRouter) shard(id int) *MemoryStore {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(id))
+	h := ringHash(b[:])
+	i := sort.Search(len(r.ring), func(i int) bool { return r.ring[i].hash >= h })
+	if i == len(r.ring) {
+		i = 0
+	}
+	return r.shards[r.ring[i].shard]
+}
+
+// merge collects the items fetch returns for every shard, ordered by ID.
+func (r *ShardedRouter) merge(fetch func(s *MemoryStore) []Item) []Item {
+	var items []Item
+	for _, s := range r.shards {
+		items = append(items, fetch(s)...)
+	}
+	sortItemsByID(items)
+	return items
+}
+
+func (r *ShardedRouter) GetItem(id int) (Item, error) { return r.shard(id).GetItem(id) }
+
+func (r *ShardedRouter) Exists(id int) bool { return r.shard(id).Exists(id) }
+
+func (r *ShardedRouter) GetItems() []Item {
+	return r.merge(func(s *MemoryStore) []Item { return s.GetItems() })
+}
+
+func (r *ShardedRouter) GetItemsByIDs(ids []int) []Item {
+	byShard := make(map[*MemoryStore][]int)
+	for _, id := range ids {
+		s := r.shard(id)
+		byShard[s] = append(byShard[s], id)
+	}
+	return r.merge(func(s *MemoryStore) []Item {
+		if len(byShard[s]) == 0 {
+			return nil
+		}
+		return s.GetItemsByIDs(byShard[s])
+	})
+}
+
+func (r *ShardedRouter) GetProjectedByIDs(ids []int, f ItemFilter, fields, copied fieldMask) []ItemProjection {
+	byShard := make(map[*MemoryStore][]int)
+	for _, id := range ids {
+		s := r.shard(id)
+		byShard[s] = append(byShard[s], id)
+	}
+	var projs []ItemProjection
+	for s, shardIDs := range byShard {
+		projs = append(projs, s.GetProjectedByIDs(shardIDs, f, fields, copied)...)
+	}
+	sort.Slice(projs, func(i, j int) bool { return projs[i].ID < projs[j].ID })
+	return projs
+}
+
+func (r *ShardedRouter) FilterItems(f ItemFilter) []Item {
+	return r.merge(func(s *MemoryStore) []Item { return s.FilterItems(f) })
+}
+
+// FilterItemsContext filters the shards one after the other. When ctx is
+// done it returns the matches found so far which, unlike on a single
+// store, are not necessarily the lowest matching IDs.
+func (r *ShardedRouter) FilterItemsContext(ctx context.Context, f ItemFilter) ([]Item, error) {
+	var (
+		items []Item
+		err   error
+	)
+	for _, s := range r.shards {
+		var matched []Item
+		matched, err = s.FilterItemsContext(ctx, f)
+		items = append(items, matched...)
+		if err != nil {
+			break
+		}
+	}
+	sortItemsByID(items)
+	return items, err
+}
+
+func (r *ShardedRouter) Distinct(field string) ([]DistinctCount, error) {
+	counts := make(map[string]int)
+	for _, s := range r.shards {
+		values, err := s.Distinct(field)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			counts[v.Value] += v.Count
+		}
+	}
+	values := make([]DistinctCount, 0, len(counts))
+	for v, n := range counts {
+		values = append(values, DistinctCount{Value: v, Count: n})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Value < values[j].Value })
+	return values, nil
+}
+
+func (r *ShardedRouter) Group(field, none string) (map[string]ItemGroup, error) {
+	groups := make(map[string]ItemGroup)
+	for _, s := range r.shards {
+		part, err := s.Group(field, none)
+		if err != nil {
+			return nil, err
+		}
+		for k, p := range part {
+			g := groups[k]
+			g.Items = append(g.Items, p.Items...)
+			g.Count += p.Count
+			groups[k] = g
+		}
+	}
+	for _, g := range groups {
+		sortItemsByID(g.Items)
+	}
+	return groups, nil
+}
+
+func (r *ShardedRouter) Histogram(bounds []int) ([]HistogramBucket, error) {
+	var buckets []HistogramBucket
+	for i, s := range r.shards {
+		hist, err := s.Histogram(bounds)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			buckets = hist
+			continue
+		}
+		for j := range buckets {
+			buckets[j].Count += hist[j].Count
+		}
+	}
+	return buckets, nil
+}
+
+func (r *ShardedRouter) IDs() []int {
+	var ids []int
+	for _, s := range r.shards {
+		ids = append(ids, s.IDs()...)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (r *ShardedRouter) Len() int {
+	n := 0
+	for _, s := range r.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+func (r *ShardedRouter) MaxItem() (Item, error) {
+	return r.extremeItem((*MemoryStore).MaxItem, func(a, b int) bool { return a > b })
+}
+
+func (r *ShardedRouter) MinItem() (Item, error) {
+	return r.extremeItem((*MemoryStore).MinItem, func(a, b int) bool { return a < b })
+}
+
+func (r *ShardedRouter) extremeItem(get func(s *MemoryStore) (Item, error), better func(a, b int) bool) (Item, error) {
+	var (
+		best  Item
+		found bool
+	)
+	for _, s := range r.shards {
+		it, err := get(s)
+		if err != nil {
+			continue
+		}
+		if !found || better(it.Value, best.Value) || (it.Value == best.Value && it.ID < best.ID) {
+			best, found = it, true
+		}
+	}
+	if !found {
+		return Item{}, ErrEmpty
+	}
+	return best, nil
+}
+
+// Reindex rebuilds the indexes of every shard and returns their key
+// counts summed over the shards.
+func (r *ShardedRouter) Reindex() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sizes := make(map[string]int)
+	for _, s := range r.shards {
+		for k, n := range s.Reindex() {
+			sizes[k] += n
+		}
+	}
+	return sizes
+}
+
+func (r *ShardedRouter) ValidateItem(it Item) (Item, error) { return r.shards[0].ValidateItem(it) }
+
+func (r *ShardedRouter) Stats() StoreStats {
+	var st StoreStats
+	for _, s := range r.shards {
+		ss := s.Stats()
+		st.Adds += ss.Adds
+		st.Updates += ss.Updates
+		st.Deletes += ss.Deletes
+		st.Gets += ss.Gets
+		st.NotFound += ss.NotFound
+	}
+	return st
+}
+
+// Generation sums the generations of the shards, which only ever grow, so
+// that the sum changes whenever any shard does.
+func (r *ShardedRouter) Generation() uint64 {
+	var g uint64
+	for _, s := range r.shards {
+		g += s.Generation()
+	}
+	return g
+}
+
+func (r *ShardedRouter) Changed() <-chan struct{} { return r.changes.wait() }
+
+func (r *ShardedRouter) Flush() (int, error) { return 0, ErrNotPersistent }
+
+// idsByName returns the IDs of the items named name, on every shard.
+func (r *ShardedRouter) idsByName(name string) []int {
+	var ids []int
+	for _, s := range r.shards {
+		s.mu.RLock()
+		for id := range s.names[s.nameKey(name)] {
+			ids = append(ids, id)
+		}
+		s.mu.RUnlock()
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// checkNameLocked enforces name uniqueness, if enabled, across shards.
+// The caller holds r.mu.
+func (r *ShardedRouter) checkNameLocked(name string, self int) error {
+	if !r.shards[0].uniqueNames {
+		return nil
+	}
+	for _, id := range r.idsByName(name) {
+		if id != self {
+			return fmt.Errorf("an item named %q %w", name, ErrDuplicate)
+		}
+	}
+	return nil
+}
+
+// addLocked stores the prepared item it under the next ID. The caller
+// holds r.mu.
+func (r *ShardedRouter) addLocked(it Item) (Item, error) {
+	if err := r.checkNameLocked(it.Name, 0); err != nil {
+		return Item{}, err
+	}
+	if r.nextID > math.MaxInt-r.idStep {
+		return Item{}, ErrIDExhausted
+	}
+	s := r.shard(r.nextID)
+	now := s.clock.Now().UTC()
+	it.ID, it.CreatedAt, it.UpdatedAt = r.nextID, now, now
+	if err := s.storeItem(it); err != nil {
+		return Item{}, err
+	}
+	r.nextID += r.idStep
+	s.stats.adds.Add(1)
+	return it, nil
+}
+
+// updateLocked updates item id with the prepared item it. The caller
+// holds r.mu.
+func (r *ShardedRouter) updateLocked(id int, it Item, precond func(current Item) error) (Item, error) {
+	s := r.shard(id)
+	if !s.Exists(id) {
+		return Item{}, s.notFound(id)
+	}
+	if err := r.checkNameLocked(it.Name, id); err != nil {
+		return Item{}, err
+	}
+	return s.UpdateItemIf(id, it, precond)
+}
+
+func (r *ShardedRouter) copyLocked(id int, suffix bool) (Item, error) {
+	src, err := r.GetItem(id)
+	if err != nil {
+		return Item{}, err
+	}
+	s0 := r.shards[0]
+	cp := copyOf(src, suffix)
+	if err := validateItem(cp, s0.limits, s0.denyList); err != nil {
+		return Item{}, err
+	}
+	return r.addLocked(cp)
+}
+
+func (r *ShardedRouter) AddItem(it Item) (Item, error) {
+	it, err := r.shards[0].prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.addLocked(it)
+}
+
+func (r *ShardedRouter) AddItemIfNameAbsent(it Item) (Item, bool, error) {
+	it, err := r.shards[0].prepare(it)
+	if err != nil {
+		return Item{}, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ids := r.idsByName(it.Name); len(ids) > 0 {
+		existing, err := r.GetItem(ids[0])
+		return existing, false, err
+	}
+	created, err := r.addLocked(it)
+	if err != nil {
+		return Item{}, false, err
+	}
+	return created, true, nil
+}
+
+func (r *ShardedRouter) UpdateItem(id int, it Item) (Item, error) {
+	return r.UpdateItemIf(id, it, nil)
+}
+
+func (r *ShardedRouter) UpdateItemIf(id int, it Item, precond func(current Item) error) (Item, error) {
+	it, err := r.shards[0].prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.updateLocked(id, it, precond)
+}
+
+func (r *ShardedRouter) CopyItem(id int, suffix bool) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.copyLocked(id, suffix)
+}
+
+func (r *ShardedRouter) DeleteItem(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.shard(id).DeleteItem(id)
+}
+
+func (r *ShardedRouter) PopItem(id int) (Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.shard(id).PopItem(id)
+}
+
+func (r *ShardedRouter) Truncate(keep int) ([]Item, error) {
+	if keep < 0 {
+		var verr ValidationError
+		verr.add("keep", "must not be negative, got %d", keep)
+		return nil, &verr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := r.IDs()
+	if len(ids) <= keep {
+		return nil, nil
+	}
+	removed := make([]Item, 0, len(ids)-keep)
+	for _, id := range ids[:len(ids)-keep] {
+		it, err := r.shard(id).PopItem(id)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, it)
+	}
+	return removed, nil
+}
+
+func (r *ShardedRouter) UpsertByName(items []Item) ([]UpsertResult, error) {
+	s0 := r.shards[0]
+	seen := make(map[string]bool, len(items))
+	for i, it := range items {
+		it, err := s0.prepare(it)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		items[i] = it
+		key := s0.nameKey(it.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("item %d: duplicate name %q in payload: %w", i, it.Name, ErrValidation)
+		}
+		seen[key] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	targets := make([]int, len(items))
+	for i, it := range items {
+		ids := r.idsByName(it.Name)
+		if len(ids) > 1 {
+			return nil, fmt.Errorf("item %d: name %q matches %d items: %w", i, it.Name, len(ids), ErrConflict)
+		}
+		if len(ids) == 1 {
+			targets[i] = ids[0]
+		}
+	}
+
+	results := make([]UpsertResult, len(items))
+	for i, it := range items {
+		var (
+			stored Item
+			err    error
+		)
+		if targets[i] == 0 {
+			stored, err = r.addLocked(it)
+		} else {
+			stored, err = r.updateLocked(targets[i], it, nil)
+		}
+		if err != nil {
+			return results[:i], fmt.Errorf("item %d: %w", i, err)
+		}
+		results[i] = UpsertResult{Name: stored.Name, ID: stored.ID, Created: targets[i] == 0}
+	}
+	return results, nil
+}
+
+func (r *ShardedRouter) SwapValues(a, b int) error {
+	if a == b {
+		var verr ValidationError
+		verr.add("b", "must differ from a, both are %d", a)
+		return &verr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sa, sb := r.shard(a), r.shard(b)
+	if sa == sb {
+		return sa.SwapValues(a, b)
+	}
+	ia, err := sa.GetItem(a)
+	if err != nil {
+		return err
+	}
+	ib, err := sb.GetItem(b)
+	if err != nil {
+		return err
+	}
+	now := sa.clock.Now().UTC()
+	ia.Value, ib.Value = ib.Value, ia.Value
+	ia.UpdatedAt, ib.UpdatedAt = now, now
+	if err := sa.storeItem(ia); err != nil {
+		return err
+	}
+	sa.stats.updates.Add(1)
+	if err := sb.storeItem(ib); err != nil {
+		return err
+	}
+	sb.stats.updates.Add(1)
+	return nil
+}
+
+// WithTransaction runs fn with the router's write lock held. The shards
+// cannot be rolled back as a whole, so the transaction keeps an undo
+// action per change and, if fn fails, applies them in reverse order.
+func (r *ShardedRouter) WithTransaction(fn func(tx Tx) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &routerTx{r: r}
+	nextID := r.nextID
+	if err := fn(tx); err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		r.nextID = nextID
+		return err
+	}
+	return nil
+}
+
+// routerTx implements Tx on a ShardedRouter whose write lock is held.
+type routerTx struct {
+	r    *ShardedRouter
+	undo []func()
+}
+
+func (t *routerTx) GetItem(id int) (Item, error) { return t.r.GetItem(id) }
+
+func (t *routerTx) Exists(id int) bool { return t.r.Exists(id) }
+
+func (t *routerTx) IDsByName(name string) []int { return t.r.idsByName(name) }
+
+// Generation can only change during the transaction through its own
+// writes, as every write to the shards goes through the router lock.
+func (t *routerTx) Generation() uint64 { return t.r.Generation() }
+
+func (t *routerTx) AddItem(it Item) (Item, error) {
+	it, err := t.r.shards[0].prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+	created, err := t.r.addLocked(it)
+	if err == nil {
+		t.undoAdd(created.ID)
+	}
+	return created, err
+}
+
+func (t *routerTx) UpdateItem(id int, it Item) (Item, error) {
+	old, err := t.r.GetItem(id)
+	if err != nil {
+		return Item{}, err
+	}
+	if it, err = t.r.shards[0].prepare(it); err != nil {
+		return Item{}, err
+	}
+	updated, err := t.r.updateLocked(id, it, nil)
+	if err == nil {
+		t.undoRemove(old)
+	}
+	return updated, err
+}
+
+func (t *routerTx) CopyItem(id int, suffix bool) (Item, error) {
+	created, err := t.r.copyLocked(id, suffix)
+	if err == nil {
+		t.undoAdd(created.ID)
+	}
+	return created, err
+}
+
+func (t *routerTx) DeleteItem(id int) error {
+	old, err := t.r.GetItem(id)
+	if err != nil {
+		return err
+	}
+	if err := t.r.shard(id).DeleteItem(id); err != nil {
+		return err
+	}
+	t.undoRemove(old)
+	return nil
+}
+
+func (t *routerTx) undoAdd(id int) {
+	t.undo = append(t.undo, func() { _ = t.r.shard(id).DeleteItem(id) })
+}
+
+// undoRemove restores old as it was, over an update or a deletion.
+func (t *routerTx) undoRemove(old Item) {
+	t.undo = append(t.undo, func() { _ = t.r.shard(old.ID).storeItem(old) })
+}
+
+// storeItem stores it under its own ID as is, replacing any item with that
+// ID. It lets a ShardedRouter, which assigns IDs and timestamps itself,
+// write to its shards.
+func (s *MemoryStore) storeItem(it Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.items[it.ID]; ok {
+		s.removeLocked(cur)
+	}
+	s.putLocked(it)
+	return s.mutatedLocked()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func newTestShards(t testing.TB, n int, opts ...StoreOption) []*MemoryStore {
+	t.Helper()
+	shards := make([]*MemoryStore, n)
+	for i := range shards {
+		var err error
+		if shards[i], err = NewMemoryStore(opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return shards
+}
+
+func TestShardedRouterDistribution(t *testing.T) {
+	const items = 20000
+	for _, n := range []int{2, 3, 4, 8} {
+		t.Run(fmt.Sprintf("%d shards", n), func(t *testing.T) {
+			shards := newTestShards(t, n)
+			r, err := NewShardedRouter(1, 1, shards...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < items; i++ {
+				if _, err := r.AddItem(Item{Name: fmt.Sprintf("item-%d", i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Consistent hashing with 128 points per shard keeps every
+			// shard within a quarter of its fair share.
+			mean := items / n
+			for i, s := range shards {
+				if got := s.Len(); got < mean*3/4 || got > mean*5/4 {
+					t.Errorf("shard %d holds %d items, want about %d", i, got, mean)
+				}
+			}
+			if got := r.Len(); got != items {
+				t.Errorf("router holds %d items, want %d", got, items)
+			}
+		})
+	}
+}
+
+func TestShardedRouterRouting(t *testing.T) {
+	shards := newTestShards(t, 4, WithUniqueNames(true))
+	r, err := NewShardedRouter(10, 5, shards...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		it, err := r.AddItem(Item{Name: fmt.Sprintf("item-%d", i), Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 10 + 5*i; it.ID != want {
+			t.Fatalf("item %d got id %d, want %d", i, it.ID, want)
+		}
+		if !r.shard(it.ID).Exists(it.ID) {
+			t.Errorf("item %d is not on the shard its ID routes to", it.ID)
+		}
+		got, err := r.GetItem(it.ID)
+		if err != nil || got.Value != i {
+			t.Errorf("GetItem(%d) = %+v, %v", it.ID, got, err)
+		}
+	}
+	items := r.GetItems()
+	for i := 1; i < len(items); i++ {
+		if items[i-1].ID >= items[i].ID {
+			t.Fatalf("GetItems is not ordered by ID at %d", i)
+		}
+	}
+	if _, err := r.AddItem(Item{Name: "item-3"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("adding a duplicate name across shards: got %v, want %v", err, ErrDuplicate)
+	}
+}
+
+func TestNewShardedRouterErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, step int
+		shards      int
+	}{
+		{"no shards", 1, 1, 0},
+		{"start below 1", 0, 1, 2},
+		{"step below 1", 1, 0, 2},
+	}
+	for _, tt := range tests {
+		if _, err := NewShardedRouter(tt.start, tt.step, newTestShards(t, tt.shards)...); err == nil {
+			t.Errorf("%s: got no error", tt.name)
+		}
+	}
+}
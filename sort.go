@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sortKey is one field of a ?sort= specification.
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// itemComparators compare two items by one field, returning a negative
+// number, zero or a positive number.
+var itemComparators = map[string]func(a, b Item) int{
+	"id":         func(a, b Item) int { return compareInts(a.ID, b.ID) },
+	"name":       func(a, b Item) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"category":   func(a, b Item) int { return strings.Compare(strings.ToLower(a.Category), strings.ToLower(b.Category)) },
+	"value":      func(a, b Item) int { return compareInts(a.Value, b.Value) },
+	"created_at": func(a, b Item) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+	"updated_at": func(a, b Item) int { return compareTimes(a.UpdatedAt, b.UpdatedAt) },
+}
+
+// parseSort parses a comma-separated list of fields, each optionally
+// prefixed with "-" for descending order, such as "value,-id".
+func parseSort(v string) ([]sortKey, error) {
+	var keys []sortKey
+	seen := make(map[string]bool)
+	for _, p := range strings.Split(v, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		k := sortKey{field: strings.TrimPrefix(p, "-"), desc: strings.HasPrefix(p, "-")}
+		if _, ok := itemComparators[k.field]; !ok {
+			return nil, fmt.Errorf("invalid sort field %q, expected one of id, name, category, value, created_at, updated_at", k.field)
+		}
+		if seen[k.field] {
+			return nil, fmt.Errorf("sort field %q given twice", k.field)
+		}
+		seen[k.field] = true
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// sortItems orders items by keys, the first key taking precedence. The
+// sort is stable, so items tied on every key keep their order, which is
+// by ID for store listings.
+func sortItems(items []Item, keys []sortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return compareItems(items[i], items[j], keys) < 0
+	})
+}
+
+// compareItems compares a and b by keys, the first key taking precedence.
+func compareItems(a, b Item, keys []sortKey) int {
+	for _, k := range keys {
+		c := itemComparators[k.field](a, b)
+		if k.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
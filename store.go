@@ -0,0 +1,694 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// StoreReader is the read side of a Store, all that GET requests need. A
+// ReadReplicaStore serves it from a copy.
+type StoreReader interface {
+	GetItem(id int) (Item, error)
+	GetItems() []Item
+	GetItemsByIDs(ids []int) []Item
+	GetProjectedByIDs(ids []int, f ItemFilter, fields, copied fieldMask) []ItemProjection
+	FilterItems(f ItemFilter) []Item
+	FilterItemsContext(ctx context.Context, f ItemFilter) ([]Item, error)
+	Distinct(field string) ([]DistinctCount, error)
+	Group(field, none string) (map[string]ItemGroup, error)
+	Histogram(bounds []int) ([]HistogramBucket, error)
+	IDs() []int
+	Len() int
+	Exists(id int) bool
+	MaxItem() (Item, error)
+	MinItem() (Item, error)
+	Generation() uint64
+	Changed() <-chan struct{}
+}
+
+// Store is the item storage used by the HTTP handlers.
+type Store interface {
+	StoreReader
+	AddItem(it Item) (Item, error)
+	AddItemIfNameAbsent(it Item) (Item, bool, error)
+	UpdateItem(id int, it Item) (Item, error)
+	UpdateItemIf(id int, it Item, precond func(current Item) error) (Item, error)
+	CopyItem(id int, suffix bool) (Item, error)
+	DeleteItem(id int) error
+	PopItem(id int) (Item, error)
+	Truncate(keep int) ([]Item, error)
+	UpsertByName(items []Item) ([]UpsertResult, error)
+	SwapValues(a, b int) error
+	WithTransaction(fn func(tx Tx) error) error
+	Reindex() map[string]int
+	ValidateItem(it Item) (Item, error)
+	Stats() StoreStats
+	Flush() (int, error)
+}
+
+// MemoryStore keeps items in a map guarded by a read/write mutex.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	items  map[int]Item
+	nextID int
+	idStep int
+
+	// names indexes item IDs by name key. Several IDs share a key only
+	// when uniqueNames is off.
+	names map[string]idSet
+	// indexes holds the secondary indexes enabled by WithIndexes, by field
+	// then by key.
+	indexes        map[string]map[string]idSet
+	uniqueNames    bool
+	normalizeNames bool
+	// caseSensitiveNames keys the name index, and thus uniqueness and
+	// upserts, by the exact name rather than its lowercase form.
+	caseSensitiveNames bool
+	limits             ItemLimits
+	// denyList, when set, blocks names at validation. It may be reloaded
+	// while the store is in use.
+	denyList *NameDenyList
+	// clock stamps CreatedAt and UpdatedAt.
+	clock Clock
+
+	// persister, when set, is told about every committed mutation.
+	persister *FilePersister
+	// generation is bumped on every mutation, see Generation.
+	generation atomic.Uint64
+	// changes wakes up the waiters of Changed on every mutation. Shards of
+	// a ShardedRouter share one.
+	changes *changeNotifier
+	// view caches the items sorted by ID for lock-free readers, see
+	// sortedView.
+	view atomic.Pointer[itemsView]
+
+	stats storeCounters
+}
+
+// StoreOption configures a MemoryStore at construction.
+type StoreOption func(*MemoryStore) error
+
+// WithUniqueNames makes the store reject an item whose name is already used
+// by another item.
+func WithUniqueNames(unique bool) StoreOption {
+	return func(s *MemoryStore) error {
+		s.uniqueNames = unique
+		return nil
+	}
+}
+
+// WithNameNormalization makes the store trim names and collapse internal
+// runs of whitespace before validating and storing them.
+func WithNameNormalization(normalize bool) StoreOption {
+	return func(s *MemoryStore) error {
+		s.normalizeNames = normalize
+		return nil
+	}
+}
+
+// WithCaseSensitiveNames makes names differing only by case distinct for
+// uniqueness and upserts. By default they are the same name.
+func WithCaseSensitiveNames(sensitive bool) StoreOption {
+	return func(s *MemoryStore) error {
+		s.caseSensitiveNames = sensitive
+		return nil
+	}
+}
+
+// WithNameDenyList rejects items whose name is blocked by deny.
+func WithNameDenyList(deny *NameDenyList) StoreOption {
+	return func(s *MemoryStore) error {
+		s.denyList = deny
+		return nil
+	}
+}
+
+// WithItemLimits sets the bounds validated on every stored item.
+func WithItemLimits(lim ItemLimits) StoreOption {
+	return func(s *MemoryStore) error {
+		if lim.MaxTags < 0 || lim.MaxTagLength < 1 || lim.MaxMetadataKeys < 0 || lim.MaxMetadataBytes < 0 {
+			return fmt.Errorf("invalid item limits %+v", lim)
+		}
+		s.limits = lim
+		return nil
+	}
+}
+
+// WithIDSequence makes the store assign IDs start, start+step,
+// start+2*step, and so on. Instances given the same step and distinct
+// starts in [1, step] never generate the same ID, which lets sharded
+// deployments avoid collisions without any coordination: with step 3,
+// instances started at 1, 2 and 3 hand out 1,4,7..., 2,5,8... and 3,6,9...
+func WithIDSequence(start, step int) StoreOption {
+	return func(s *MemoryStore) error {
+		if start < 1 {
+			return fmt.Errorf("id start must be at least 1, got %d", start)
+		}
+		if step < 1 {
+			return fmt.Errorf("id step must be at least 1, got %d", step)
+		}
+		s.nextID = start
+		s.idStep = step
+		return nil
+	}
+}
+
+func NewMemoryStore(opts ...StoreOption) (*MemoryStore, error) {
+	s := &MemoryStore{
+		items:  make(map[int]Item),
+		nextID: 1,
+		idStep: 1,
+		names:  make(map[string]idSet),
+		limits: DefaultItemLimits,
+		clock:  realClock{},
+
+		changes: newChangeNotifier(),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddItem validates it, assigns a fresh ID and timestamps, and stores it.
+func (s *MemoryStore) AddItem(it Item) (Item, error) {
+	it, err := s.prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created, err := s.addLocked(it)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := s.mutatedLocked(); err != nil {
+		return Item{}, err
+	}
+	return created, nil
+}
+
+// AddItemIfNameAbsent adds it only if no stored item has its name, checking
+// and inserting under the same write lock. It reports whether the item was
+// created; when it was not, the returned item is one of those already
+// carrying the name.
+func (s *MemoryStore) AddItemIfNameAbsent(it Item) (Item, bool, error) {
+	it, err := s.prepare(it)
+	if err != nil {
+		return Item{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ids := s.names[s.nameKey(it.Name)]; len(ids) > 0 {
+		first := 0
+		for id := range ids {
+			if first == 0 || id < first {
+				first = id
+			}
+		}
+		return s.items[first], false, nil
+	}
+	created, err := s.addLocked(it)
+	if err != nil {
+		return Item{}, false, err
+	}
+	if err := s.mutatedLocked(); err != nil {
+		return Item{}, false, err
+	}
+	return created, true, nil
+}
+
+func (s *MemoryStore) addLocked(it Item) (Item, error) {
+	if err := s.checkNameLocked(it.Name, 0); err != nil {
+		return Item{}, err
+	}
+	// Refuse the ID whose successor would overflow, so nextID never wraps
+	// around into IDs that may already be taken.
+	if s.nextID > math.MaxInt-s.idStep {
+		return Item{}, ErrIDExhausted
+	}
+	now := s.clock.Now().UTC()
+	it.ID = s.nextID
+	it.CreatedAt = now
+	it.UpdatedAt = now
+	s.putLocked(it)
+	s.nextID += s.idStep
+	s.stats.adds.Add(1)
+	return it, nil
+}
+
+func (s *MemoryStore) GetItem(id int) (Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.stats.gets.Add(1)
+	it, ok := s.items[id]
+	if !ok {
+		return Item{}, s.notFound(id)
+	}
+	return it, nil
+}
+
+// GetItemsByIDs returns the stored items among ids, ordered by ID. Unknown
+// and repeated IDs are skipped.
+func (s *MemoryStore) GetItemsByIDs(ids []int) []Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]Item, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		s.stats.gets.Add(1)
+		if it, ok := s.items[id]; ok {
+			items = append(items, it)
+		}
+	}
+	sortItemsByID(items)
+	return items
+}
+
+// Len returns the number of stored items.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.items)
+}
+
+// Exists reports whether item id is stored, without copying it.
+func (s *MemoryStore) Exists(id int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.items[id]
+	return ok
+}
+
+// GetItems returns a copy of every item, ordered by ID. The copy is taken
+// from the sorted view, so writers are not blocked while it is made.
+func (s *MemoryStore) GetItems() []Item {
+	view := s.sortedView()
+	items := make([]Item, len(view))
+	copy(items, view)
+	return items
+}
+
+// itemsView is an immutable copy of the items, sorted by ID, as of one
+// generation of the store.
+type itemsView struct {
+	generation uint64
+	items      []Item
+}
+
+// sortedView returns every item ordered by ID. The slice is shared between
+// readers and must not be modified. It is rebuilt, under the read lock, by
+// the first reader after a mutation; further readers of the same
+// generation iterate it without taking the lock at all.
+func (s *MemoryStore) sortedView() []Item {
+	if v := s.view.Load(); v != nil && v.generation == s.generation.Load() {
+		return v.items
+	}
+
+	s.mu.RLock()
+	items := make([]Item, 0, len(s.items))
+	for _, it := range s.items {
+		items = append(items, it)
+	}
+	// Writers bump the generation under the write lock, so it cannot move
+	// while the read lock is held.
+	gen := s.generation.Load()
+	s.mu.RUnlock()
+
+	sortItemsByID(items)
+	s.view.Store(&itemsView{generation: gen, items: items})
+	return items
+}
+
+func sortItemsByID(items []Item) {
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+}
+
+// MaxItem returns the item with the highest value, the lowest ID winning
+// ties.
+func (s *MemoryStore) MaxItem() (Item, error) {
+	return s.extremeItem(func(a, b int) bool { return a > b })
+}
+
+// MinItem returns the item with the lowest value, the lowest ID winning
+// ties.
+func (s *MemoryStore) MinItem() (Item, error) {
+	return s.extremeItem(func(a, b int) bool { return a < b })
+}
+
+// extremeItem scans the store once for the item whose value beats all
+// others according to better.
+func (s *MemoryStore) extremeItem(better func(a, b int) bool) (Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		best  Item
+		found bool
+	)
+	for _, it := range s.items {
+		if !found || better(it.Value, best.Value) || (it.Value == best.Value && it.ID < best.ID) {
+			best, found = it, true
+		}
+	}
+	if !found {
+		return Item{}, ErrEmpty
+	}
+	return best, nil
+}
+
+// IDs returns the IDs of all stored items in ascending order. It is used
+// by callers that walk the store one item at a time instead of copying it.
+func (s *MemoryStore) IDs() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// UpdateItem replaces the client-controlled fields of item id, keeping its
+// ID and creation time.
+func (s *MemoryStore) UpdateItem(id int, it Item) (Item, error) {
+	return s.UpdateItemIf(id, it, nil)
+}
+
+// UpdateItemIf is UpdateItem guarded by a precondition: precond, unless
+// nil, is called with the current item under the write lock and the update
+// only happens if it returns nil. Its error is returned as is.
+func (s *MemoryStore) UpdateItemIf(id int, it Item, precond func(current Item) error) (Item, error) {
+	it, err := s.prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if precond != nil {
+		current, ok := s.items[id]
+		if !ok {
+			return Item{}, s.notFound(id)
+		}
+		if err := precond(current); err != nil {
+			return Item{}, err
+		}
+	}
+	updated, err := s.updateLocked(id, it)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := s.mutatedLocked(); err != nil {
+		return Item{}, err
+	}
+	return updated, nil
+}
+
+func (s *MemoryStore) updateLocked(id int, it Item) (Item, error) {
+	old, ok := s.items[id]
+	if !ok {
+		return Item{}, s.notFound(id)
+	}
+	if err := s.checkNameLocked(it.Name, id); err != nil {
+		return Item{}, err
+	}
+	it.ID = id
+	it.CreatedAt = old.CreatedAt
+	it.UpdatedAt = s.clock.Now().UTC()
+	s.removeLocked(old)
+	s.putLocked(it)
+	s.stats.updates.Add(1)
+	return it, nil
+}
+
+// CopyItem stores a copy of item id under a fresh ID, appending " (copy)"
+// to its name when suffix is set. Reading the source and adding the copy
+// happen under the same write lock.
+func (s *MemoryStore) CopyItem(id int, suffix bool) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created, err := s.copyLocked(id, suffix)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := s.mutatedLocked(); err != nil {
+		return Item{}, err
+	}
+	return created, nil
+}
+
+func (s *MemoryStore) copyLocked(id int, suffix bool) (Item, error) {
+	src, ok := s.items[id]
+	if !ok {
+		return Item{}, s.notFound(id)
+	}
+	cp := copyOf(src, suffix)
+	if err := validateItem(cp, s.limits, s.denyList); err != nil {
+		return Item{}, err
+	}
+	return s.addLocked(cp)
+}
+
+// copyOf returns the client-controlled fields of src as a new item, its
+// name suffixed with " (copy)" when suffix is set.
+func copyOf(src Item, suffix bool) Item {
+	cp := Item{Name: src.Name, Category: src.Category, Value: src.Value, Tags: trimTags(src.Tags), Metadata: copyMetadata(src.Metadata)}
+	if suffix {
+		cp.Name += " (copy)"
+	}
+	return cp
+}
+
+func (s *MemoryStore) DeleteItem(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.deleteLocked(id); err != nil {
+		return err
+	}
+	return s.mutatedLocked()
+}
+
+func (s *MemoryStore) deleteLocked(id int) error {
+	it, ok := s.items[id]
+	if !ok {
+		return s.notFound(id)
+	}
+	s.removeLocked(it)
+	s.stats.deletes.Add(1)
+	return nil
+}
+
+// PopItem deletes item id and returns it, both under the same write lock,
+// so that of several concurrent callers only one gets the item.
+func (s *MemoryStore) PopItem(id int) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[id]
+	if !ok {
+		return Item{}, s.notFound(id)
+	}
+	s.removeLocked(it)
+	s.stats.deletes.Add(1)
+	if err := s.mutatedLocked(); err != nil {
+		return Item{}, err
+	}
+	return it, nil
+}
+
+// Truncate keeps the keep items with the highest IDs, the most recently
+// created ones, and deletes the others under one write lock. It returns
+// the items deleted, by ID.
+func (s *MemoryStore) Truncate(keep int) ([]Item, error) {
+	if keep < 0 {
+		var verr ValidationError
+		verr.add("keep", "must not be negative, got %d", keep)
+		return nil, &verr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.items) <= keep {
+		return nil, nil
+	}
+	ids := make([]int, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	removed := make([]Item, len(ids)-keep)
+	for i, id := range ids[:len(removed)] {
+		removed[i] = s.items[id]
+		s.removeLocked(removed[i])
+	}
+	s.stats.deletes.Add(int64(len(removed)))
+	if err := s.mutatedLocked(); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// prepare normalizes an incoming item, when enabled, and validates it. It
+// runs before any lookup so the name index only ever sees stored forms.
+func (s *MemoryStore) prepare(it Item) (Item, error) {
+	if s.normalizeNames {
+		it.Name = normalizeName(it.Name)
+	}
+	it.Tags = trimTags(it.Tags)
+	it.Metadata = copyMetadata(it.Metadata)
+	if err := validateItem(it, s.limits, s.denyList); err != nil {
+		return Item{}, err
+	}
+	return it, nil
+}
+
+// ValidateItem runs the same normalization and validation as AddItem and
+// returns the item as it would be stored, without storing it.
+func (s *MemoryStore) ValidateItem(it Item) (Item, error) {
+	return s.prepare(it)
+}
+
+// putLocked stores it and indexes it.
+func (s *MemoryStore) putLocked(it Item) {
+	s.items[it.ID] = it
+	key := s.nameKey(it.Name)
+	if s.names[key] == nil {
+		s.names[key] = make(idSet)
+	}
+	s.names[key][it.ID] = struct{}{}
+	s.indexLocked(it)
+}
+
+// removeLocked drops it from the items map and the indexes.
+func (s *MemoryStore) removeLocked(it Item) {
+	delete(s.items, it.ID)
+	key := s.nameKey(it.Name)
+	delete(s.names[key], it.ID)
+	if len(s.names[key]) == 0 {
+		delete(s.names, key)
+	}
+	s.unindexLocked(it)
+}
+
+// checkNameLocked enforces name uniqueness, if enabled, for an item named
+// name. self is the ID of the item being updated, or 0 on creation.
+func (s *MemoryStore) checkNameLocked(name string, self int) error {
+	if !s.uniqueNames {
+		return nil
+	}
+	for id := range s.names[s.nameKey(name)] {
+		if id != self {
+			return fmt.Errorf("an item named %q %w", name, ErrDuplicate)
+		}
+	}
+	return nil
+}
+
+// mutatedLocked bumps the generation and tells the persister, if any, that
+// the store changed. Every
+// public method that modifies items calls it before releasing the write
+// lock. When persistence fails the change stays in memory and the error is
+// returned to the caller.
+func (s *MemoryStore) mutatedLocked() error {
+	s.generation.Add(1)
+	s.changes.notify()
+	if s.persister == nil {
+		return nil
+	}
+	if err := s.persister.mutated(s); err != nil {
+		return fmt.Errorf("persisting change: %w", err)
+	}
+	return nil
+}
+
+// notFound records a failed lookup of item id and returns its error.
+func (s *MemoryStore) notFound(id int) error {
+	s.stats.notFound.Add(1)
+	return fmt.Errorf("item %d %w", id, ErrNotFound)
+}
+
+// nameKey is the form under which names are indexed: the name itself, or
+// its lowercase form unless names are case-sensitive.
+func (s *MemoryStore) nameKey(name string) string {
+	if s.caseSensitiveNames {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+type idSet map[int]struct{}
+
+// storeCounters count store operations. They are atomics rather than
+// fields guarded by mu so that reading them never contends with writers.
+type storeCounters struct {
+	adds, updates, deletes, gets, notFound atomic.Int64
+}
+
+// StoreStats is a point-in-time copy of the store operation counters.
+type StoreStats struct {
+	Adds     int64 `json:"adds"`
+	Updates  int64 `json:"updates"`
+	Deletes  int64 `json:"deletes"`
+	Gets     int64 `json:"gets"`
+	NotFound int64 `json:"not_found"`
+}
+
+// Flush writes the store to disk, if it is persisted, and returns the
+// number of items written.
+func (s *MemoryStore) Flush() (int, error) {
+	if s.persister == nil {
+		return 0, ErrNotPersistent
+	}
+	return s.persister.Flush()
+}
+
+// Generation returns a counter incremented on every mutation of the store.
+// Two reads returning the same generation saw the same contents.
+func (s *MemoryStore) Generation() uint64 {
+	return s.generation.Load()
+}
+
+// Changed returns a channel closed at the next mutation of the store. A
+// caller reads the generation after taking the channel, so that a mutation
+// in between is not missed.
+func (s *MemoryStore) Changed() <-chan struct{} {
+	return s.changes.wait()
+}
+
+// Stats returns the operation counters accumulated since the store was
+// created.
+func (s *MemoryStore) Stats() StoreStats {
+	return StoreStats{
+		Adds:     s.stats.adds.Load(),
+		Updates:  s.stats.updates.Load(),
+		Deletes:  s.stats.deletes.Load(),
+		Gets:     s.stats.gets.Load(),
+		NotFound: s.stats.notFound.Load(),
+	}
+}
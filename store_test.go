@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// newBenchStore returns a store holding n items.
+func newBenchStore(b testing.TB, n int, opts ...StoreOption) *MemoryStore {
+	b.Helper()
+	s, err := NewMemoryStore(opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		it := Item{Name: fmt.Sprintf("item-%d", i), Category: fmt.Sprintf("cat-%d", i%50), Value: i % 1000, Tags: []string{"a", "b"}}
+		if _, err := s.AddItem(it); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return s
+}
+
+// lockedCopy is GetItems as it was before the sorted view: a copy of the
+// items made and sorted while holding the read lock.
+func lockedCopy(s *MemoryStore) []Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]Item, 0, len(s.items))
+	for _, it := range s.items {
+		items = append(items, it)
+	}
+	sortItemsByID(items)
+	return items
+}
+
+// BenchmarkGetItems measures read throughput with and without a writer
+// updating an item in a loop, for the sorted view and for the copy made
+// under the lock it replaced.
+func BenchmarkGetItems(b *testing.B) {
+	reads := []struct {
+		name string
+		get  func(s *MemoryStore) []Item
+	}{
+		{"view", (*MemoryStore).GetItems},
+		{"locked-copy", lockedCopy},
+	}
+	for _, rd := range reads {
+		for _, writes := range []bool{false, true} {
+			name := rd.name + "/idle"
+			if writes {
+				name = rd.name + "/concurrent-writes"
+			}
+			b.Run(name, func(b *testing.B) {
+				s := newBenchStore(b, 10000)
+				var stop atomic.Bool
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					for i := 0; writes && !stop.Load(); i++ {
+						_, _ = s.UpdateItem(1, Item{Name: "item-0", Value: i % 1000})
+					}
+				}()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if items := rd.get(s); len(items) != 10000 {
+							b.Errorf("got %d items", len(items))
+						}
+					}
+				})
+				b.StopTimer()
+				stop.Store(true)
+				<-done
+			})
+		}
+	}
+}
+
+func TestSortedView(t *testing.T) {
+	s := newBenchStore(t, 100)
+	first := s.sortedView()
+	if second := s.sortedView(); &first[0] != &second[0] {
+		t.Error("the view was rebuilt without a mutation")
+	}
+	if _, err := s.UpdateItem(5, Item{Name: "changed", Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	view := s.sortedView()
+	if &view[0] == &first[0] {
+		t.Fatal("the view was not rebuilt after a mutation")
+	}
+	if view[4].Name != "changed" || first[4].Name != "item-4" {
+		t.Errorf("got %q in the new view, %q in the old one", view[4].Name, first[4].Name)
+	}
+	items := s.GetItems()
+	items[0].Name = "mutated"
+	if s.sortedView()[0].Name == "mutated" {
+		t.Error("GetItems shares its slice with the view")
+	}
+}
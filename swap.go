@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// SwapValues exchanges the values of items a and b under one write lock,
+// so no reader sees both items with the same value or either one changed
+// alone. Both items get a new UpdatedAt.
+func (s *MemoryStore) SwapValues(a, b int) error {
+	if a == b {
+		var verr ValidationError
+		verr.add("b", "must differ from a, both are %d", a)
+		return &verr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ia, ok := s.items[a]
+	if !ok {
+		return s.notFound(a)
+	}
+	ib, ok := s.items[b]
+	if !ok {
+		return s.notFound(b)
+	}
+	// The items are re-indexed, since the value index keys them by value.
+	s.removeLocked(ia)
+	s.removeLocked(ib)
+	now := s.clock.Now().UTC()
+	ia.Value, ib.Value = ib.Value, ia.Value
+	ia.UpdatedAt, ib.UpdatedAt = now, now
+	s.putLocked(ia)
+	s.putLocked(ib)
+	s.stats.updates.Add(2)
+	return s.mutatedLocked()
+}
+
+// swapHandler serves POST /items/swap?a=A&b=B.
+func (s *Server) swapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r, "a", "b") {
+		return
+	}
+	q := r.URL.Query()
+	var ids [2]int
+	for i, key := range []string{"a", "b"} {
+		v := q.Get(key)
+		id, err := s.parseItemID(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid or missing %s %q", key, v))
+			return
+		}
+		ids[i] = id
+	}
+	if err := s.store.SwapValues(ids[0], ids[1]); err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
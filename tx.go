@@ -0,0 +1,291 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Tx is the view of the store given to a WithTransaction closure. Its
+// calls run under the transaction's lock and are undone together if the
+// closure fails.
+type Tx interface {
+	GetItem(id int) (Item, error)
+	Exists(id int) bool
+	// IDsByName returns the IDs, sorted, of the items named name, matched
+	// as the uniqueness check does.
+	IDsByName(name string) []int
+	// Generation is the generation of the store when the transaction
+	// started; it cannot change until the transaction ends.
+	Generation() uint64
+	AddItem(it Item) (Item, error)
+	UpdateItem(id int, it Item) (Item, error)
+	CopyItem(id int, suffix bool) (Item, error)
+	DeleteItem(id int) error
+}
+
+// WithTransaction runs fn with the write lock held for its whole duration,
+// so that the store calls it makes through tx are atomic as a group. If fn
+// returns an error every change it made is rolled back and the error is
+// returned. fn must only use tx: calling the store itself would deadlock,
+// which also means transactions cannot be nested.
+//
+// The items a transaction touches are saved the first time it does, and
+// rollback only puts those back, so a transaction costs in proportion to
+// the items it changes rather than to the store.
+func (s *MemoryStore) WithTransaction(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memTx{s: s, nextID: s.nextID}
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	if !tx.changed {
+		return nil
+	}
+	return s.mutatedLocked()
+}
+
+// undoEntry is an item as it was before a transaction first touched it,
+// or its absence.
+type undoEntry struct {
+	id      int
+	item    Item
+	existed bool
+}
+
+// memTx implements Tx on a MemoryStore whose write lock is held.
+type memTx struct {
+	s       *MemoryStore
+	changed bool
+	// undo holds the items touched, in the order they were first touched,
+	// and nextID the ID sequence when the transaction started.
+	undo    []undoEntry
+	touched map[int]bool
+	nextID  int
+}
+
+// save records item id as it is, unless the transaction touched it
+// already, before a change to it.
+func (t *memTx) save(id int) {
+	if t.touched[id] {
+		return
+	}
+	if t.touched == nil {
+		t.touched = make(map[int]bool)
+	}
+	t.touched[id] = true
+	it, ok := t.s.items[id]
+	t.undo = append(t.undo, undoEntry{id: id, item: it, existed: ok})
+}
+
+// rollback puts the touched items back as saved, newest first, with their
+// indexes, and rewinds the ID sequence.
+func (t *memTx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		e := t.undo[i]
+		if cur, ok := t.s.items[e.id]; ok {
+			t.s.removeLocked(cur)
+		}
+		if e.existed {
+			t.s.putLocked(e.item)
+		}
+	}
+	t.s.nextID = t.nextID
+}
+
+func (t *memTx) GetItem(id int) (Item, error) {
+	t.s.stats.gets.Add(1)
+	it, ok := t.s.items[id]
+	if !ok {
+		return Item{}, t.s.notFound(id)
+	}
+	return it, nil
+}
+
+func (t *memTx) Exists(id int) bool {
+	_, ok := t.s.items[id]
+	return ok
+}
+
+func (t *memTx) IDsByName(name string) []int {
+	ids := make([]int, 0, len(t.s.names[t.s.nameKey(name)]))
+	for id := range t.s.names[t.s.nameKey(name)] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (t *memTx) Generation() uint64 {
+	return t.s.generation.Load()
+}
+
+func (t *memTx) AddItem(it Item) (Item, error) {
+	it, err := t.s.prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+	// New items take the next ID of the sequence.
+	t.save(t.s.nextID)
+	created, err := t.s.addLocked(it)
+	if err == nil {
+		t.changed = true
+	}
+	return created, err
+}
+
+func (t *memTx) UpdateItem(id int, it Item) (Item, error) {
+	it, err := t.s.prepare(it)
+	if err != nil {
+		return Item{}, err
+	}
+	t.save(id)
+	updated, err := t.s.updateLocked(id, it)
+	if err == nil {
+		t.changed = true
+	}
+	return updated, err
+}
+
+func (t *memTx) CopyItem(id int, suffix bool) (Item, error) {
+	t.save(t.s.nextID)
+	created, err := t.s.copyLocked(id, suffix)
+	if err == nil {
+		t.changed = true
+	}
+	return created, err
+}
+
+func (t *memTx) DeleteItem(id int) error {
+	t.save(id)
+	err := t.s.deleteLocked(id)
+	if err == nil {
+		t.changed = true
+	}
+	return err
+}
+
+// recordingTx records the calls of a transaction, which RecordingStore
+// writes out once it commits.
+type recordingTx struct {
+	Tx
+	ops []recordedOp
+}
+
+func (t *recordingTx) AddItem(it Item) (Item, error) {
+	created, err := t.Tx.AddItem(it)
+	if err == nil {
+		t.ops = append(t.ops, recordedOp{Op: opAdd, Item: &it})
+	}
+	return created, err
+}
+
+func (t *recordingTx) UpdateItem(id int, it Item) (Item, error) {
+	updated, err := t.Tx.UpdateItem(id, it)
+	if err == nil {
+		t.ops = append(t.ops, recordedOp{Op: opUpdate, ID: id, Item: &it})
+	}
+	return updated, err
+}
+
+func (t *recordingTx) CopyItem(id int, suffix bool) (Item, error) {
+	created, err := t.Tx.CopyItem(id, suffix)
+	if err == nil {
+		t.ops = append(t.ops, recordedOp{Op: opCopy, ID: id, Suffix: suffix})
+	}
+	return created, err
+}
+
+func (t *recordingTx) DeleteItem(id int) error {
+	err := t.Tx.DeleteItem(id)
+	if err == nil {
+		t.ops = append(t.ops, recordedOp{Op: opDelete, ID: id})
+	}
+	return err
+}
+
+// WithTransaction records the calls of a committed transaction as the
+// plain operations they are made of; a rolled back transaction left the
+// store untouched and is not recorded. Failed calls inside a transaction
+// that still commits are left out too, as they changed nothing.
+func (r *RecordingStore) WithTransaction(fn func(tx Tx) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rtx *recordingTx
+	err := r.Store.WithTransaction(func(tx Tx) error {
+		rtx = &recordingTx{Tx: tx}
+		return fn(rtx)
+	})
+	if err == nil && rtx != nil {
+		for _, op := range rtx.ops {
+			r.record(op, nil)
+		}
+	}
+	return err
+}
+
+// eventTx collects the events of a transaction, which EventStore
+// publishes once it commits.
+type eventTx struct {
+	Tx
+	events []Event
+}
+
+func (t *eventTx) add(typ string, it Item) {
+	ev := Event{Type: typ, Time: time.Now().UTC(), ID: it.ID}
+	if typ != eventDeleted {
+		ev.Item = &it
+	}
+	t.events = append(t.events, ev)
+}
+
+func (t *eventTx) AddItem(it Item) (Item, error) {
+	created, err := t.Tx.AddItem(it)
+	if err == nil {
+		t.add(eventCreated, created)
+	}
+	return created, err
+}
+
+func (t *eventTx) UpdateItem(id int, it Item) (Item, error) {
+	updated, err := t.Tx.UpdateItem(id, it)
+	if err == nil {
+		t.add(eventUpdated, updated)
+	}
+	return updated, err
+}
+
+func (t *eventTx) CopyItem(id int, suffix bool) (Item, error) {
+	created, err := t.Tx.CopyItem(id, suffix)
+	if err == nil {
+		t.add(eventCreated, created)
+	}
+	return created, err
+}
+
+func (t *eventTx) DeleteItem(id int) error {
+	err := t.Tx.DeleteItem(id)
+	if err == nil {
+		t.add(eventDeleted, Item{ID: id})
+	}
+	return err
+}
+
+// WithTransaction publishes the events of a transaction only once it
+// commits, so that subscribers never see a change that was rolled back.
+func (e *EventStore) WithTransaction(fn func(tx Tx) error) error {
+	var etx *eventTx
+	err := e.Store.WithTransaction(func(tx Tx) error {
+		etx = &eventTx{Tx: tx}
+		return fn(etx)
+	})
+	if err == nil && etx != nil {
+		for _, ev := range etx.events {
+			e.bus.Publish(ev)
+		}
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWithTransactionRollback(t *testing.T) {
+	s := newBenchStore(t, 5, WithUniqueNames(true), WithIndexes("category", "value"))
+	before := s.GetItems()
+	boom := errors.New("boom")
+	err := s.WithTransaction(func(tx Tx) error {
+		if _, err := tx.UpdateItem(1, Item{Name: "renamed", Category: "moved", Value: 500}); err != nil {
+			return err
+		}
+		if _, err := tx.UpdateItem(1, Item{Name: "renamed again", Category: "moved", Value: 501}); err != nil {
+			return err
+		}
+		if err := tx.DeleteItem(2); err != nil {
+			return err
+		}
+		if _, err := tx.AddItem(Item{Name: "item-1", Category: "new"}); err != nil {
+			return err
+		}
+		if _, err := tx.CopyItem(3, true); err != nil {
+			return err
+		}
+		if _, err := tx.AddItem(Item{Name: "item-3"}); err == nil {
+			t.Error("a duplicate name was added")
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("got %v, want the error of the transaction", err)
+	}
+	if got := s.GetItems(); !reflect.DeepEqual(got, before) {
+		t.Errorf("after rollback got %v, want %v", got, before)
+	}
+
+	// The indexes were rolled back along with the items.
+	if got := s.FilterItems(ItemFilter{Category: "moved"}); len(got) != 0 {
+		t.Errorf("category index still holds %v", got)
+	}
+	if got := itemIDs(s.FilterItems(ItemFilter{Category: "cat-1"})); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("category index holds %v, want [2]", got)
+	}
+	if _, err := s.AddItem(Item{Name: "renamed"}); err != nil {
+		t.Errorf("name of the rolled back update still taken: %v", err)
+	}
+	if _, err := s.AddItem(Item{Name: "item-1"}); err == nil {
+		t.Error("name of the restored item is free")
+	}
+	created, err := s.AddItem(Item{Name: "next"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != 7 {
+		t.Errorf("got ID %d after the rollback, want the sequence rewound to 7", created.ID)
+	}
+}
+
+func TestWithTransactionCommit(t *testing.T) {
+	s := newBenchStore(t, 3)
+	gen := s.Generation()
+	err := s.WithTransaction(func(tx Tx) error {
+		if err := tx.DeleteItem(1); err != nil {
+			return err
+		}
+		_, err := tx.AddItem(Item{Name: "added"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemIDs(s.GetItems()); !reflect.DeepEqual(got, []int{2, 3, 4}) {
+		t.Errorf("got items %v, want [2 3 4]", got)
+	}
+	if s.Generation() == gen {
+		t.Error("the generation did not move")
+	}
+	gen = s.Generation()
+	if err := s.WithTransaction(func(tx Tx) error { return nil }); err != nil || s.Generation() != gen {
+		t.Errorf("an empty transaction moved the generation or failed: %v", err)
+	}
+}
+
+// BenchmarkWithTransaction measures a one-item transaction, as increment
+// runs, over stores of growing size: what it adds to the update itself
+// should not grow with the store.
+func BenchmarkWithTransaction(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			s := newBenchStore(b, n)
+			for i := 0; i < b.N; i++ {
+				err := s.WithTransaction(func(tx Tx) error {
+					it, err := tx.GetItem(1)
+					if err != nil {
+						return err
+					}
+					it.Value++
+					_, err = tx.UpdateItem(1, it)
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
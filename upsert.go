@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// UpsertResult reports what UpsertByName did with one input item.
+type UpsertResult struct {
+	Name    string `json:"name"`
+	ID      int    `json:"id"`
+	Created bool   `json:"created"`
+}
+
+// UpsertByName updates the item carrying the same name as each input item,
+// or creates it when there is none. The whole batch is applied under one
+// write lock and is rejected without changes if any input is invalid, a
+// name appears twice in the batch, or a name matches several items.
+func (s *MemoryStore) UpsertByName(items []Item) ([]UpsertResult, error) {
+	seen := make(map[string]bool, len(items))
+	for i, it := range items {
+		it, err := s.prepare(it)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		items[i] = it
+		key := s.nameKey(it.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("item %d: duplicate name %q in payload: %w", i, it.Name, ErrValidation)
+		}
+		seen[key] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	targets := make([]int, len(items))
+	for i, it := range items {
+		ids := s.names[s.nameKey(it.Name)]
+		if len(ids) > 1 {
+			return nil, fmt.Errorf("item %d: name %q matches %d items: %w", i, it.Name, len(ids), ErrConflict)
+		}
+		for id := range ids {
+			targets[i] = id
+		}
+	}
+
+	results := make([]UpsertResult, len(items))
+	for i, it := range items {
+		var (
+			stored Item
+			err    error
+		)
+		if targets[i] == 0 {
+			stored, err = s.addLocked(it)
+		} else {
+			stored, err = s.updateLocked(targets[i], it)
+		}
+		if err != nil {
+			// Only reachable when the id space runs out mid-batch.
+			if i > 0 {
+				_ = s.mutatedLocked()
+			}
+			return results[:i], fmt.Errorf("item %d: %w", i, err)
+		}
+		results[i] = UpsertResult{Name: stored.Name, ID: stored.ID, Created: targets[i] == 0}
+	}
+	if err := s.mutatedLocked(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// upsertInTx is UpsertByName made of transaction calls, for the upserts
+// that must be part of a wider transaction. The items must have been
+// through ValidateItem first, so that their names match the index.
+func upsertInTx(tx Tx, items []Item) ([]UpsertResult, error) {
+	touched := make(map[int]bool, len(items))
+	results := make([]UpsertResult, len(items))
+	for i, it := range items {
+		ids := tx.IDsByName(it.Name)
+		if len(ids) > 1 {
+			return nil, fmt.Errorf("item %d: name %q matches %d items: %w", i, it.Name, len(ids), ErrConflict)
+		}
+		var (
+			stored Item
+			err    error
+		)
+		switch {
+		case len(ids) == 0:
+			stored, err = tx.AddItem(it)
+		case touched[ids[0]]:
+			err = fmt.Errorf("duplicate name %q in payload: %w", it.Name, ErrValidation)
+		default:
+			stored, err = tx.UpdateItem(ids[0], it)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		touched[stored.ID] = true
+		results[i] = UpsertResult{Name: stored.Name, ID: stored.ID, Created: len(ids) == 0}
+	}
+	return results, nil
+}
+
+// bulkUpsertByNameHandler serves POST /items/bulk-upsert-by-name. With
+// If-Generation-Match the upsert runs in a transaction that first checks
+// the store generation, and answers 412 if the store changed.
+func (s *Server) bulkUpsertByNameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.checkQuery(w, r) {
+		return
+	}
+	gen, conditional, err := ifGenerationMatch(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var items []Item
+	if !s.decodeBody(w, r, &items) {
+		return
+	}
+	if len(items) > s.cfg.Elements.MaxBatchItems {
+		writeError(w, http.StatusRequestEntityTooLarge, s.cfg.Elements.tooManyItems().Error())
+		return
+	}
+	var results []UpsertResult
+	if conditional {
+		for i := range items {
+			if items[i], err = s.store.ValidateItem(items[i]); err != nil {
+				s.writeStoreError(w, fmt.Errorf("item %d: %w", i, err))
+				return
+			}
+		}
+		err = s.store.WithTransaction(func(tx Tx) error {
+			if err := checkGeneration(tx, gen); err != nil {
+				return err
+			}
+			results, err = upsertInTx(tx, items)
+			return err
+		})
+	} else {
+		results, err = s.store.UpsertByName(items)
+	}
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeList(w, r, results, len(results), nil)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// itemValue is the body of /items/{id}/value.
+type itemValue struct {
+	Value *int `json:"value"`
+}
+
+// valueHandler serves /items/{id}/value: GET answers {"value": N} and PUT
+// sets the value alone from the same document. The write goes through the
+// merge patch path, so it is retried on concurrent changes, honours
+// If-Match and leaves every other field as it is.
+func (s *Server) valueHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if !s.checkQuery(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		it, err := s.reads.GetItem(id)
+		if err != nil {
+			s.writeStoreError(w, err)
+			return
+		}
+		w.Header().Set("ETag", itemETag(it))
+		s.writeData(w, r, http.StatusOK, itemValue{Value: &it.Value}, nil)
+	case http.MethodPut:
+		if err := checkContentType(r, "application/json"); err != nil {
+			writeError(w, http.StatusUnsupportedMediaType, err.Error())
+			return
+		}
+		var body itemValue
+		if err := decodeJSON(w, r, s.cfg.MaxBodyBytes, s.cfg.JSONLimits, &body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("malformed value: %v", describeDecodeError(err)))
+			return
+		}
+		if body.Value == nil {
+			var verr ValidationError
+			verr.add("value", "is required")
+			s.writeStoreError(w, &verr)
+			return
+		}
+		updated, ok := s.patchItem(w, r, id, map[string]any{"value": *body.Value})
+		if !ok {
+			return
+		}
+		w.Header().Set("ETag", itemETag(updated))
+		s.writeData(w, r, http.StatusOK, itemValue{Value: &updated.Value}, nil)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
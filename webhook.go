@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookSink POSTs every event as JSON to one URL, with the item IDs
+// clients see: tokens when ids is set.
+type webhookSink struct {
+	url    string
+	client *http.Client
+	ids    *IDCodec
+}
+
+func newWebhookSink(url string, timeout time.Duration, ids *IDCodec) *webhookSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: timeout}, ids: ids}
+}
+
+// Deliver fails on transport errors and on any non-2xx answer.
+func (s *webhookSink) Deliver(ev Event) error {
+	body, err := json.Marshal(s.ids.event(ev))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	_, _ = io.CopyN(io.Discard, resp.Body, 4096)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSinkIDs(t *testing.T) {
+	codec := NewIDCodec("test-salt")
+	tests := []struct {
+		name string
+		ids  *IDCodec
+		id   string
+	}{
+		{"plain", nil, "7"},
+		{"obfuscated", codec, fmt.Sprintf("%q", codec.Encode(7))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := make(chan string, 2)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				bodies <- string(b)
+			}))
+			defer srv.Close()
+			sink := newWebhookSink(srv.URL, time.Second, tt.ids)
+
+			it := Item{ID: 7, Name: "widget"}
+			if err := sink.Deliver(Event{Type: eventUpdated, ID: 7, Item: &it}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := <-bodies, `"id":`+tt.id; strings.Count(got, want) != 2 {
+				t.Errorf("got %s, want the event and item ids as %s", got, tt.id)
+			}
+			if err := sink.Deliver(Event{Type: eventDeleted, ID: 7}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := <-bodies, `"id":`+tt.id; !strings.HasSuffix(got, want+"}") {
+				t.Errorf("got %s, want the id as %s and no item", got, tt.id)
+			}
+		})
+	}
+}
+
+func TestWebhookSinkStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	err := newWebhookSink(srv.URL, time.Second, nil).Deliver(Event{Type: eventDeleted, ID: 1})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("got %v, want the 502 reported", err)
+	}
+}